@@ -0,0 +1,122 @@
+package absint
+
+import "github.com/KeitaTakenouchi/grammars/dsl"
+
+// Value is an abstract value of a Domain, a set of concrete values.
+type Value interface{}
+
+// Domain is a lattice of abstract values where Alpha abstracts a concrete
+// value and Contains tells whether a concrete value is in the abstract one.
+type Domain interface {
+	Top() Value
+	Alpha(concrete interface{}) Value
+	Join(a, b Value) Value
+	Contains(a Value, concrete interface{}) bool
+}
+
+// Transfer computes the abstract value of a node from the abstract values
+// of its children. It must be monotone for the pruning to be sound.
+type Transfer func(node *dsl.ProgramTree, env dsl.Env, args []Value) Value
+
+// Interpreter evaluates partial programs abstractly, where a hole is Top and
+// an unfilled terminal is the join of the values it can be filled with.
+type Interpreter struct {
+	domain    Domain
+	transfers map[*dsl.Symbol]Transfer
+}
+
+func NewInterpreter(domain Domain) *Interpreter {
+	return &Interpreter{
+		domain:    domain,
+		transfers: make(map[*dsl.Symbol]Transfer),
+	}
+}
+
+func (in *Interpreter) Domain() Domain {
+	return in.domain
+}
+
+func (in *Interpreter) Register(s *dsl.Symbol, t Transfer) *Interpreter {
+	in.transfers[s] = t
+	return in
+}
+
+// Eval returns the abstract value of the tree, where candidates returns the
+// values an unfilled terminal can be filled with, or nil if unknown.
+func (in *Interpreter) Eval(t *dsl.ProgramTree, env dsl.Env, candidates func(*dsl.Symbol) []interface{}) Value {
+	if len(t.Children) == 0 && !t.Symbol.IsTerminal() {
+		return in.domain.Top()
+	}
+	f, ok := in.transfers[t.Symbol]
+	if !ok {
+		if len(t.Children) == 1 {
+			return in.Eval(t.Children[0], env, candidates)
+		}
+		return in.domain.Top()
+	}
+	if _, filled := t.Value(); len(t.Children) == 0 && !filled {
+		var values []interface{}
+		if candidates != nil {
+			values = candidates(t.Symbol)
+		}
+		if len(values) == 0 {
+			return in.domain.Top()
+		}
+		var ret Value
+		for i, v := range values {
+			a := f(dsl.NewProgramTree(t.Symbol).With(v), env, nil)
+			if i == 0 {
+				ret = a
+			} else {
+				ret = in.domain.Join(ret, a)
+			}
+		}
+		return ret
+	}
+
+	args := make([]Value, len(t.Children))
+	for i, c := range t.Children {
+		args[i] = in.Eval(c, env, candidates)
+	}
+	return f(t, env, args)
+}
+
+// Feasible reports whether the tree may evaluate to the output, that is,
+// false only if no completion of the tree does.
+func (in *Interpreter) Feasible(t *dsl.ProgramTree, env dsl.Env, output interface{}, candidates func(*dsl.Symbol) []interface{}) bool {
+	return in.domain.Contains(in.Eval(t, env, candidates), output)
+}
+
+// Constant is the Transfer of the nodes whose value is the value itself.
+func Constant(d Domain) Transfer {
+	return func(node *dsl.ProgramTree, env dsl.Env, args []Value) Value {
+		val, ok := node.Value()
+		if !ok {
+			return d.Top()
+		}
+		return d.Alpha(val)
+	}
+}
+
+// Argument is the Transfer of the nodes whose value is the index of an
+// argument in the Env.
+func Argument(d Domain) Transfer {
+	return func(node *dsl.ProgramTree, env dsl.Env, args []Value) Value {
+		i, ok := dsl.ValueOf[int](node)
+		if !ok {
+			return d.Top()
+		}
+		arg, err := env.Arg(i)
+		if err != nil {
+			return d.Top()
+		}
+		return d.Alpha(arg)
+	}
+}
+
+// Always is the Transfer of the nodes whose values are always in a.
+func Always(a Value) Transfer {
+	return func(node *dsl.ProgramTree, env dsl.Env, args []Value) Value {
+		return a
+	}
+}
@@ -0,0 +1,180 @@
+package absint
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+func TestInterpreter_Intervals(t *testing.T) {
+	exp := dsl.NewSymbol("exp")
+	plus := dsl.NewSymbol("add")
+	minus := dsl.NewSymbol("minus")
+	mult := dsl.NewSymbol("mult")
+	cnst := dsl.NewSymbol("const")
+	param := dsl.NewSymbol("param")
+
+	node := func(s *dsl.Symbol, children ...*dsl.ProgramTree) *dsl.ProgramTree {
+		n := dsl.NewProgramTree(s)
+		n.AddChildren(children...)
+		e := dsl.NewProgramTree(exp)
+		e.AddChildren(n)
+		return e
+	}
+	leaf := func(s *dsl.Symbol, value interface{}) *dsl.ProgramTree {
+		e := dsl.NewProgramTree(exp)
+		n := dsl.NewProgramTree(s)
+		if value != nil {
+			n.With(value)
+		}
+		e.AddChildren(n)
+		return e
+	}
+
+	d := IntervalDomain{}
+	in := NewInterpreter(d).
+		Register(plus, IntervalBinary(Interval.Add)).
+		Register(minus, IntervalBinary(Interval.Sub)).
+		Register(mult, IntervalBinary(Interval.Mul)).
+		Register(cnst, Constant(d)).
+		Register(param, Argument(d))
+	candidates := func(s *dsl.Symbol) []interface{} {
+		switch s {
+		case cnst:
+			return []interface{}{1, 2}
+		case param:
+			return []interface{}{0}
+		}
+		return nil
+	}
+	hole := dsl.NewProgramTree(exp)
+
+	tests := []struct {
+		name string
+		pgm  *dsl.ProgramTree
+		want Interval
+	}{
+		{name: "hole", pgm: hole, want: TopInterval},
+		{name: "filled", pgm: node(plus, leaf(cnst, 1), leaf(param, 0)), want: Point(4)},
+		{name: "unfilled constant", pgm: node(mult, leaf(cnst, nil), leaf(param, 0)), want: NewInterval(3, 6)},
+		{name: "minus", pgm: node(minus, leaf(cnst, nil), leaf(param, 0)), want: NewInterval(-2, -1)},
+		{name: "hole in a sum", pgm: node(plus, hole, leaf(cnst, 1)), want: TopInterval},
+		{name: "hole times zero", pgm: node(mult, hole, leaf(cnst, 0)), want: Point(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := in.Eval(tt.pgm, dsl.NewEnv(3), candidates); got != tt.want {
+				t.Errorf("Interpreter.Eval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if in.Feasible(node(mult, leaf(cnst, nil), leaf(param, 0)), dsl.NewEnv(3), 7, candidates) {
+		t.Errorf("Interpreter.Feasible() = true for 7 not in [3, 6]")
+	}
+	if !in.Feasible(node(plus, hole, leaf(cnst, 1)), dsl.NewEnv(3), 7, candidates) {
+		t.Errorf("Interpreter.Feasible() = false for a hole")
+	}
+}
+
+func TestInterpreter_Feasible_Top(t *testing.T) {
+	hole := dsl.NewProgramTree(dsl.NewSymbol("S"))
+	outputs := []interface{}{5, []int{1}, "abc", [][]interface{}{{1, "a"}}, struct{ A int }{1}}
+	for _, d := range []Domain{IntervalDomain{}, SignDomain{}, TypeDomain{}, LengthDomain{}, ShapeDomain{}} {
+		in := NewInterpreter(d)
+		for _, output := range outputs {
+			if !in.Feasible(hole, dsl.NewEnv(), output, nil) {
+				t.Errorf("Interpreter.Feasible() with %T = false for a hole and %v", d, output)
+			}
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Sign
+		want Sign
+	}{
+		{name: "+ + +", got: Positive.Add(Positive), want: Positive},
+		{name: "+ + -", got: Positive.Add(Negative), want: TopSign},
+		{name: "0 + -", got: Zero.Add(Negative), want: Negative},
+		{name: "- * -", got: Negative.Mul(Negative), want: Positive},
+		{name: "{-,+} * 0", got: (Negative | Positive).Mul(Zero), want: Zero},
+		{name: "{0,+} * -", got: (Zero | Positive).Mul(Negative), want: Negative | Zero},
+		{name: "+ - +", got: Positive.Sub(Positive), want: TopSign},
+		{name: "0 - +", got: Zero.Sub(Positive), want: Negative},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("Sign = %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomains(t *testing.T) {
+	intType := reflect.TypeOf(0)
+	strType := reflect.TypeOf("")
+	unbounded := Interval{Lo: 0, Hi: math.Inf(1)}
+
+	tests := []struct {
+		name     string
+		domain   Domain
+		a        Value
+		concrete interface{}
+		want     bool
+	}{
+		{name: "interval", domain: IntervalDomain{}, a: NewInterval(1, 3), concrete: 2, want: true},
+		{name: "interval excludes", domain: IntervalDomain{}, a: NewInterval(1, 3), concrete: 4.5, want: false},
+		{name: "interval of a non-number", domain: IntervalDomain{}, a: NewInterval(1, 3), concrete: "a", want: false},
+		{name: "top interval", domain: IntervalDomain{}, a: TopInterval, concrete: "a", want: true},
+		{name: "sign", domain: SignDomain{}, a: Negative | Zero, concrete: 0, want: true},
+		{name: "sign excludes", domain: SignDomain{}, a: Negative | Zero, concrete: 2, want: false},
+		{name: "types", domain: TypeDomain{}, a: NewTypeSet(intType, strType), concrete: "a", want: true},
+		{name: "types exclude", domain: TypeDomain{}, a: NewTypeSet(intType), concrete: "a", want: false},
+		{name: "any type", domain: TypeDomain{}, a: TypeDomain{}.Top(), concrete: 1.5, want: true},
+		{name: "length", domain: LengthDomain{}, a: NewInterval(2, 3), concrete: "abc", want: true},
+		{name: "length excludes", domain: LengthDomain{}, a: NewInterval(2, 3), concrete: []int{1}, want: false},
+		{name: "length of a number", domain: LengthDomain{}, a: NewInterval(0, 3), concrete: 1, want: false},
+		{name: "top length", domain: LengthDomain{}, a: unbounded, concrete: 1, want: true},
+		{
+			name:     "shape",
+			domain:   ShapeDomain{},
+			a:        Shape{Rows: NewInterval(0, 2), Cols: Point(2)},
+			concrete: [][]interface{}{{1, "a"}, {2, "b"}},
+			want:     true,
+		},
+		{
+			name:     "shape excludes",
+			domain:   ShapeDomain{},
+			a:        Shape{Rows: NewInterval(0, 2), Cols: Point(3)},
+			concrete: [][]interface{}{{1, "a"}, {2, "b"}},
+			want:     false,
+		},
+		{
+			name:     "shape of rows",
+			domain:   ShapeDomain{},
+			a:        Shape{Rows: NewInterval(0, 2), Cols: Point(2)},
+			concrete: []int{1},
+			want:     false,
+		},
+		{name: "top shape", domain: ShapeDomain{}, a: ShapeDomain{}.Top(), concrete: []int{1}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.domain.Contains(tt.a, tt.concrete); got != tt.want {
+				t.Errorf("Domain.Contains(%v, %v) = %v, want %v", tt.a, tt.concrete, got, tt.want)
+			}
+			if tt.want && !tt.domain.Contains(tt.domain.Join(tt.a, tt.domain.Alpha(tt.concrete)), tt.concrete) {
+				t.Errorf("Domain.Join() loses %v", tt.concrete)
+			}
+			if !tt.domain.Contains(tt.domain.Alpha(tt.concrete), tt.concrete) && tt.want {
+				t.Errorf("Domain.Alpha(%v) doesn't contain it", tt.concrete)
+			}
+		})
+	}
+}
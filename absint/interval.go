@@ -0,0 +1,125 @@
+package absint
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+// Interval is the set of numbers from Lo to Hi, which may be infinite.
+type Interval struct {
+	Lo, Hi float64
+}
+
+func NewInterval(lo, hi float64) Interval {
+	return Interval{Lo: lo, Hi: hi}
+}
+
+func Point(v float64) Interval {
+	return Interval{Lo: v, Hi: v}
+}
+
+var TopInterval = Interval{Lo: math.Inf(-1), Hi: math.Inf(1)}
+
+func (a Interval) IsEmpty() bool {
+	return a.Lo > a.Hi
+}
+
+func (a Interval) Contains(v float64) bool {
+	return a.Lo <= v && v <= a.Hi
+}
+
+func (a Interval) Join(b Interval) Interval {
+	return Interval{Lo: math.Min(a.Lo, b.Lo), Hi: math.Max(a.Hi, b.Hi)}
+}
+
+func (a Interval) Add(b Interval) Interval {
+	return Interval{Lo: a.Lo + b.Lo, Hi: a.Hi + b.Hi}
+}
+
+func (a Interval) Neg() Interval {
+	return Interval{Lo: -a.Hi, Hi: -a.Lo}
+}
+
+func (a Interval) Sub(b Interval) Interval {
+	return a.Add(b.Neg())
+}
+
+func (a Interval) Mul(b Interval) Interval {
+	ps := []float64{mul(a.Lo, b.Lo), mul(a.Lo, b.Hi), mul(a.Hi, b.Lo), mul(a.Hi, b.Hi)}
+	ret := Interval{Lo: ps[0], Hi: ps[0]}
+	for _, p := range ps[1:] {
+		ret.Lo, ret.Hi = math.Min(ret.Lo, p), math.Max(ret.Hi, p)
+	}
+	return ret
+}
+
+// mul is the product where 0 times infinity is 0, as the bounds of the
+// intervals are.
+func mul(a, b float64) float64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return a * b
+}
+
+func (a Interval) String() string {
+	return fmt.Sprintf("[%v, %v]", a.Lo, a.Hi)
+}
+
+// IntervalDomain abstracts numbers by intervals.
+type IntervalDomain struct{}
+
+func (IntervalDomain) Top() Value {
+	return TopInterval
+}
+
+func (IntervalDomain) Alpha(concrete interface{}) Value {
+	v, ok := toFloat(concrete)
+	if !ok {
+		return TopInterval
+	}
+	return Point(v)
+}
+
+func (IntervalDomain) Join(a, b Value) Value {
+	return a.(Interval).Join(b.(Interval))
+}
+
+func (IntervalDomain) Contains(a Value, concrete interface{}) bool {
+	v, ok := toFloat(concrete)
+	if !ok {
+		return a.(Interval) == TopInterval
+	}
+	return a.(Interval).Contains(v)
+}
+
+// IntervalBinary lifts an operation on intervals to a Transfer.
+func IntervalBinary(op func(a, b Interval) Interval) Transfer {
+	return func(_ *dsl.ProgramTree, _ dsl.Env, args []Value) Value {
+		if len(args) != 2 {
+			return TopInterval
+		}
+		a, ok1 := args[0].(Interval)
+		b, ok2 := args[1].(Interval)
+		if !ok1 || !ok2 {
+			return TopInterval
+		}
+		return op(a, b)
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,106 @@
+package absint
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// LengthDomain abstracts strings, slices, arrays and maps by the intervals
+// of their lengths.
+type LengthDomain struct{}
+
+func (LengthDomain) Top() Value {
+	return Interval{Lo: 0, Hi: math.Inf(1)}
+}
+
+func (d LengthDomain) Alpha(concrete interface{}) Value {
+	n, ok := length(concrete)
+	if !ok {
+		return d.Top()
+	}
+	return Point(float64(n))
+}
+
+func (LengthDomain) Join(a, b Value) Value {
+	return a.(Interval).Join(b.(Interval))
+}
+
+func (d LengthDomain) Contains(a Value, concrete interface{}) bool {
+	n, ok := length(concrete)
+	if !ok {
+		return a.(Interval) == d.Top()
+	}
+	return a.(Interval).Contains(float64(n))
+}
+
+func length(v interface{}) (int, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len(), true
+	}
+	return 0, false
+}
+
+// Shape is the set of tables, slices of rows, of the numbers of rows and
+// columns in the intervals.
+type Shape struct {
+	Rows, Cols Interval
+}
+
+func (a Shape) Join(b Shape) Shape {
+	return Shape{Rows: a.Rows.Join(b.Rows), Cols: a.Cols.Join(b.Cols)}
+}
+
+func (a Shape) String() string {
+	return fmt.Sprintf("%v x %v", a.Rows, a.Cols)
+}
+
+// ShapeDomain abstracts tables by their shapes, where the number of columns
+// is the length of the first row.
+type ShapeDomain struct{}
+
+func (ShapeDomain) Top() Value {
+	unbounded := Interval{Lo: 0, Hi: math.Inf(1)}
+	return Shape{Rows: unbounded, Cols: unbounded}
+}
+
+func (d ShapeDomain) Alpha(concrete interface{}) Value {
+	rows, cols, ok := shape(concrete)
+	if !ok {
+		return d.Top()
+	}
+	return Shape{Rows: Point(float64(rows)), Cols: Point(float64(cols))}
+}
+
+func (ShapeDomain) Join(a, b Value) Value {
+	return a.(Shape).Join(b.(Shape))
+}
+
+func (d ShapeDomain) Contains(a Value, concrete interface{}) bool {
+	rows, cols, ok := shape(concrete)
+	if !ok {
+		return a.(Shape) == d.Top()
+	}
+	s := a.(Shape)
+	return s.Rows.Contains(float64(rows)) && (rows == 0 || s.Cols.Contains(float64(cols)))
+}
+
+func shape(v interface{}) (rows, cols int, ok bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return 0, 0, false
+	}
+	if rv.Len() == 0 {
+		return 0, 0, true
+	}
+	first := rv.Index(0)
+	if first.Kind() == reflect.Interface {
+		first = first.Elem()
+	}
+	if first.Kind() != reflect.Slice && first.Kind() != reflect.Array {
+		return 0, 0, false
+	}
+	return rv.Len(), first.Len(), true
+}
@@ -0,0 +1,134 @@
+package absint
+
+import (
+	"strings"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+// Sign is a set of signs of numbers.
+type Sign uint8
+
+const (
+	Negative Sign = 1 << iota
+	Zero
+	Positive
+
+	TopSign = Negative | Zero | Positive
+)
+
+func signOf(v float64) Sign {
+	switch {
+	case v < 0:
+		return Negative
+	case v > 0:
+		return Positive
+	}
+	return Zero
+}
+
+// lift applies the operation on single signs to every pair of signs.
+func (a Sign) lift(b Sign, op func(x, y Sign) Sign) Sign {
+	var ret Sign
+	for x := Negative; x <= Positive; x <<= 1 {
+		for y := Negative; y <= Positive; y <<= 1 {
+			if a&x != 0 && b&y != 0 {
+				ret |= op(x, y)
+			}
+		}
+	}
+	return ret
+}
+
+func (a Sign) Add(b Sign) Sign {
+	return a.lift(b, func(x, y Sign) Sign {
+		switch {
+		case x == Zero:
+			return y
+		case y == Zero || x == y:
+			return x
+		}
+		return TopSign
+	})
+}
+
+func (a Sign) Neg() Sign {
+	ret := a & Zero
+	if a&Negative != 0 {
+		ret |= Positive
+	}
+	if a&Positive != 0 {
+		ret |= Negative
+	}
+	return ret
+}
+
+func (a Sign) Sub(b Sign) Sign {
+	return a.Add(b.Neg())
+}
+
+func (a Sign) Mul(b Sign) Sign {
+	return a.lift(b, func(x, y Sign) Sign {
+		switch {
+		case x == Zero || y == Zero:
+			return Zero
+		case x == y:
+			return Positive
+		}
+		return Negative
+	})
+}
+
+func (a Sign) String() string {
+	var strs []string
+	for _, s := range []struct {
+		sign Sign
+		str  string
+	}{{Negative, "-"}, {Zero, "0"}, {Positive, "+"}} {
+		if a&s.sign != 0 {
+			strs = append(strs, s.str)
+		}
+	}
+	return "{" + strings.Join(strs, ",") + "}"
+}
+
+// SignDomain abstracts numbers by their signs.
+type SignDomain struct{}
+
+func (SignDomain) Top() Value {
+	return TopSign
+}
+
+func (SignDomain) Alpha(concrete interface{}) Value {
+	v, ok := toFloat(concrete)
+	if !ok {
+		return TopSign
+	}
+	return signOf(v)
+}
+
+func (SignDomain) Join(a, b Value) Value {
+	return a.(Sign) | b.(Sign)
+}
+
+func (SignDomain) Contains(a Value, concrete interface{}) bool {
+	v, ok := toFloat(concrete)
+	if !ok {
+		return a.(Sign) == TopSign
+	}
+	return a.(Sign)&signOf(v) != 0
+}
+
+func SignBinary(op func(a, b Sign) Sign) Transfer {
+	return func(_ *dsl.ProgramTree, _ dsl.Env, args []Value) Value {
+		if len(args) != 2 {
+			return TopSign
+		}
+		a, ok1 := args[0].(Sign)
+		b, ok2 := args[1].(Sign)
+		if !ok1 || !ok2 {
+			return TopSign
+		}
+		return op(a, b)
+	}
+}
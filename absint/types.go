@@ -0,0 +1,84 @@
+package absint
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// TypeSet is a set of the dynamic types of values, or any type.
+type TypeSet struct {
+	Any   bool
+	Types []reflect.Type
+}
+
+func NewTypeSet(types ...reflect.Type) TypeSet {
+	ret := TypeSet{}
+	for _, t := range types {
+		ret = ret.add(t)
+	}
+	return ret
+}
+
+func (a TypeSet) Has(t reflect.Type) bool {
+	if a.Any {
+		return true
+	}
+	for _, u := range a.Types {
+		if u == t {
+			return true
+		}
+	}
+	return false
+}
+
+func (a TypeSet) add(t reflect.Type) TypeSet {
+	if a.Has(t) {
+		return a
+	}
+	types := append(append([]reflect.Type{}, a.Types...), t)
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].String() < types[j].String()
+	})
+	return TypeSet{Types: types}
+}
+
+func (a TypeSet) Join(b TypeSet) TypeSet {
+	if a.Any || b.Any {
+		return TypeSet{Any: true}
+	}
+	for _, t := range b.Types {
+		a = a.add(t)
+	}
+	return a
+}
+
+func (a TypeSet) String() string {
+	if a.Any {
+		return "any"
+	}
+	strs := make([]string, len(a.Types))
+	for i, t := range a.Types {
+		strs[i] = t.String()
+	}
+	return "{" + strings.Join(strs, ",") + "}"
+}
+
+// TypeDomain abstracts values by their dynamic types.
+type TypeDomain struct{}
+
+func (TypeDomain) Top() Value {
+	return TypeSet{Any: true}
+}
+
+func (TypeDomain) Alpha(concrete interface{}) Value {
+	return NewTypeSet(reflect.TypeOf(concrete))
+}
+
+func (TypeDomain) Join(a, b Value) Value {
+	return a.(TypeSet).Join(b.(TypeSet))
+}
+
+func (TypeDomain) Contains(a Value, concrete interface{}) bool {
+	return a.(TypeSet).Has(reflect.TypeOf(concrete))
+}
@@ -0,0 +1,125 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+const help = `commands:
+  s, step          stop at the next node
+  c, continue      run to the next breakpoint
+  b, break <sym>   stop at the nodes of the symbol
+  d, delete <sym>  remove the breakpoint
+  p, print         print the node, the arguments and the variables
+  h, help          print this help
+`
+
+// Debugger is a Tracer stopping the evaluation at the nodes to read
+// commands, starting with stepping into the root.
+type Debugger struct {
+	in          *bufio.Scanner
+	out         io.Writer
+	breakpoints map[string]struct{}
+	stepping    bool
+}
+
+func New(in io.Reader, out io.Writer) *Debugger {
+	return &Debugger{
+		in:          bufio.NewScanner(in),
+		out:         out,
+		breakpoints: make(map[string]struct{}),
+		stepping:    true,
+	}
+}
+
+// Break sets a breakpoint at the nodes of the symbol id.
+func (d *Debugger) Break(id string) *Debugger {
+	d.breakpoints[id] = struct{}{}
+	return d
+}
+
+func (d *Debugger) Continue() *Debugger {
+	d.stepping = false
+	return d
+}
+
+func (d *Debugger) Enter(p dsl.Path, node *dsl.ProgramTree, env dsl.Env) {
+	_, ok := d.breakpoints[node.Symbol.Id]
+	if !d.stepping && !ok {
+		return
+	}
+	fmt.Fprintf(d.out, "enter %s %s\n", p, label(node))
+	d.prompt(node, env)
+}
+
+func (d *Debugger) Leave(p dsl.Path, node *dsl.ProgramTree, env dsl.Env, result dsl.EvalResult) {
+	if !d.stepping {
+		return
+	}
+	fmt.Fprintf(d.out, "leave %s %s => %s\n", p, label(node), outcome(result))
+	d.prompt(node, env)
+}
+
+func (d *Debugger) prompt(node *dsl.ProgramTree, env dsl.Env) {
+	for {
+		fmt.Fprint(d.out, "(debug) ")
+		if !d.in.Scan() {
+			// run to the end without the input
+			fmt.Fprintln(d.out)
+			d.stepping = false
+			d.breakpoints = make(map[string]struct{})
+			return
+		}
+		fields := strings.Fields(d.in.Text())
+		if len(fields) == 0 {
+			fields = []string{"s"}
+		}
+		switch cmd, args := fields[0], fields[1:]; {
+		case cmd == "s" || cmd == "step":
+			d.stepping = true
+			return
+		case cmd == "c" || cmd == "continue":
+			d.stepping = false
+			return
+		case (cmd == "b" || cmd == "break") && len(args) == 1:
+			d.Break(args[0])
+		case (cmd == "d" || cmd == "delete") && len(args) == 1:
+			delete(d.breakpoints, args[0])
+		case cmd == "p" || cmd == "print":
+			fmt.Fprintln(d.out, node)
+			for i := 0; i < env.ArgCount(); i++ {
+				arg, _ := env.Arg(i)
+				fmt.Fprintf(d.out, "  arg %d = %v\n", i, arg)
+			}
+			for _, name := range env.Names() {
+				val, _ := env.Lookup(name)
+				fmt.Fprintf(d.out, "  %s = %v\n", name, val)
+			}
+		case cmd == "h" || cmd == "help":
+			fmt.Fprint(d.out, help)
+		default:
+			fmt.Fprintf(d.out, "unknown command %q, type h for help\n", d.in.Text())
+		}
+	}
+}
+
+func label(node *dsl.ProgramTree) string {
+	if val, ok := node.Value(); ok {
+		return fmt.Sprintf("%s(%v)", node.Symbol, val)
+	}
+	return node.Symbol.String()
+}
+
+func outcome(result dsl.EvalResult) string {
+	if err := result.Err(); err != nil {
+		return "error: " + err.Error()
+	}
+	if val, ok := result.Value(); ok {
+		return fmt.Sprint(val)
+	}
+	return "no value"
+}
@@ -0,0 +1,85 @@
+package debugger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+func newTestEvaluator() (dsl.Evaluator, *dsl.ProgramTree) {
+	S := dsl.NewSymbol("S")
+	plus := dsl.NewSymbol("add")
+	cnst := dsl.NewSymbol("const")
+	param := dsl.NewSymbol("param")
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, plus)
+	gram.AddRule(plus, cnst, param)
+
+	evaluator := dsl.NewSemantics(&gram).
+		Register(plus, dsl.Binary(func(a, b int) int { return a + b })).
+		RegisterLeaf(cnst, dsl.Constant).
+		RegisterLeaf(param, dsl.Argument).
+		Evaluator()
+
+	tree := dsl.NewProgramTree(S)
+	add := dsl.NewProgramTree(plus)
+	add.AddChildren(dsl.NewProgramTree(cnst).With(1), dsl.NewProgramTree(param).With(0))
+	tree.AddChildren(add)
+	return evaluator, tree
+}
+
+func TestDebugger(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "continue",
+			input: "c\n",
+			want:  "enter / S\n(debug) ",
+		},
+		{
+			name:  "step",
+			input: "s\n\nc\n",
+			want:  "enter / S\n(debug) enter /0 add\n(debug) enter /0/0 \"const\"(1)\n(debug) ",
+		},
+		{
+			name:  "breakpoint",
+			input: "b param\nc\np\nc\n",
+			want: "enter / S\n(debug) (debug) enter /0/1 \"param\"(0)\n" +
+				"(debug) \"param\"(0)\n  arg 0 = 9\n(debug) ",
+		},
+		{
+			name:  "step out of a node",
+			input: "b const\nc\ns\nc\n",
+			want: "enter / S\n(debug) (debug) enter /0/0 \"const\"(1)\n" +
+				"(debug) leave /0/0 \"const\"(1) => 1\n(debug) ",
+		},
+		{
+			name:  "end of the input",
+			input: "",
+			want:  "enter / S\n(debug) \n",
+		},
+		{
+			name:  "unknown command",
+			input: "x\nc\n",
+			want:  "enter / S\n(debug) unknown command \"x\", type h for help\n(debug) ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluator, tree := newTestEvaluator()
+			var out strings.Builder
+			d := New(strings.NewReader(tt.input), &out)
+			result := evaluator.Eval(tree, dsl.NewEnv(9).WithTracer(d))
+			if got, _ := result.Value(); got != 10 {
+				t.Errorf("Evaluator.Eval() = %v, want %v", got, 10)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+type Kind int
+
+const (
+	Delete Kind = iota
+	Insert
+	Relabel
+	Update
+	Move
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Delete:
+		return "delete"
+	case Insert:
+		return "insert"
+	case Relabel:
+		return "relabel"
+	case Update:
+		return "update"
+	case Move:
+		return "move"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Edit is an operation on a single node, except Move which moves a whole
+// subtree. From is the path of the node in the old tree and To the path in
+// the new tree; the one that does not apply to the kind is nil.
+type Edit struct {
+	Kind Kind
+	From dsl.Path
+	To   dsl.Path
+	Old  *dsl.ProgramTree
+	New  *dsl.ProgramTree
+}
+
+func (e Edit) String() string {
+	switch e.Kind {
+	case Delete:
+		return fmt.Sprintf("delete %s at %v", label(e.Old), e.From)
+	case Insert:
+		return fmt.Sprintf("insert %s at %v", label(e.New), e.To)
+	case Move:
+		return fmt.Sprintf("move %s from %v to %v", label(e.Old), e.From, e.To)
+	}
+	return fmt.Sprintf("%s %s to %s at %v", e.Kind, label(e.Old), label(e.New), e.From)
+}
+
+func label(n *dsl.ProgramTree) string {
+	if val, ok := n.Value(); ok {
+		return fmt.Sprintf("%s(%v)", n.Symbol, val)
+	}
+	return n.Symbol.String()
+}
+
+// Script is the edit script turning one tree into another. Distance is the
+// Zhang-Shasha tree edit distance with unit costs, in which a moved subtree
+// counts as the deletion and insertion of all of its nodes.
+type Script struct {
+	Edits    []Edit
+	Distance int
+
+	old, new *indexedTree
+	mapping  map[int]int // post-order index of old to that of new
+}
+
+type indexedTree struct {
+	nodes    []*dsl.ProgramTree // in post-order, 1-based
+	paths    []dsl.Path
+	leftmost []int
+	keyroots []int
+}
+
+func index(t *dsl.ProgramTree) *indexedTree {
+	it := &indexedTree{
+		nodes: []*dsl.ProgramTree{nil},
+		paths: []dsl.Path{nil},
+	}
+	for p, n := range t.PostOrder() {
+		it.nodes = append(it.nodes, n)
+		it.paths = append(it.paths, p.Clone())
+	}
+	it.leftmost = make([]int, len(it.nodes))
+	it.fillLeftmost(t, new(int))
+	// a keyroot is the highest node of each leftmost leaf
+	seen := make(map[int]bool)
+	for i := it.size(); i >= 1; i-- {
+		if !seen[it.leftmost[i]] {
+			seen[it.leftmost[i]] = true
+			it.keyroots = append([]int{i}, it.keyroots...)
+		}
+	}
+	return it
+}
+
+func (it *indexedTree) fillLeftmost(n *dsl.ProgramTree, counter *int) int {
+	leftmost := 0
+	for i, c := range n.Children {
+		l := it.fillLeftmost(c, counter)
+		if i == 0 {
+			leftmost = l
+		}
+	}
+	*counter++
+	if len(n.Children) == 0 {
+		leftmost = *counter
+	}
+	it.leftmost[*counter] = leftmost
+	return leftmost
+}
+
+func (it *indexedTree) size() int {
+	return len(it.nodes) - 1
+}
+
+func valueOf(n *dsl.ProgramTree) interface{} {
+	val, _ := n.Value()
+	return val
+}
+
+func renameCost(a, b *dsl.ProgramTree) int {
+	if a.Symbol == b.Symbol && dsl.EqualValue(valueOf(a), valueOf(b)) {
+		return 0
+	}
+	return 1
+}
+
+type differ struct {
+	a, b     *indexedTree
+	treeDist [][]int
+}
+
+// forestDist fills the distances between the forests ending at i and j.
+// Row x and column y of the table stand for the nodes l(i)+x-1 and l(j)+y-1.
+func (d *differ) forestDist(i, j int, record bool) [][]int {
+	li, lj := d.a.leftmost[i], d.b.leftmost[j]
+	fd := make([][]int, i-li+2)
+	for x := range fd {
+		fd[x] = make([]int, j-lj+2)
+	}
+	for x := 1; x < len(fd); x++ {
+		fd[x][0] = fd[x-1][0] + 1
+	}
+	for y := 1; y < len(fd[0]); y++ {
+		fd[0][y] = fd[0][y-1] + 1
+	}
+	for x := li; x <= i; x++ {
+		for y := lj; y <= j; y++ {
+			xi, yj := x-li+1, y-lj+1
+			del, ins := fd[xi-1][yj]+1, fd[xi][yj-1]+1
+			if d.a.leftmost[x] == li && d.b.leftmost[y] == lj {
+				fd[xi][yj] = min(del, ins, fd[xi-1][yj-1]+renameCost(d.a.nodes[x], d.b.nodes[y]))
+				if record {
+					d.treeDist[x][y] = fd[xi][yj]
+				}
+			} else {
+				sub := fd[d.a.leftmost[x]-li][d.b.leftmost[y]-lj] + d.treeDist[x][y]
+				fd[xi][yj] = min(del, ins, sub)
+			}
+		}
+	}
+	return fd
+}
+
+// mapping recovers the matched node pairs of an optimal edit script.
+func (d *differ) mapping() map[int]int {
+	ret := make(map[int]int)
+	type pair struct{ i, j int }
+	stack := []pair{{d.a.size(), d.b.size()}}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		i, j := p.i, p.j
+		if i == 0 || j == 0 {
+			continue
+		}
+		li, lj := d.a.leftmost[i], d.b.leftmost[j]
+		fd := d.forestDist(i, j, false)
+		x, y := i, j
+		for x >= li && y >= lj {
+			xi, yj := x-li+1, y-lj+1
+			switch {
+			case fd[xi][yj] == fd[xi-1][yj]+1:
+				x--
+			case fd[xi][yj] == fd[xi][yj-1]+1:
+				y--
+			case d.a.leftmost[x] == li && d.b.leftmost[y] == lj:
+				ret[x] = y
+				x--
+				y--
+			default:
+				stack = append(stack, pair{x, y})
+				x = d.a.leftmost[x] - 1
+				y = d.b.leftmost[y] - 1
+			}
+		}
+	}
+	return ret
+}
+
+func Diff(a, b *dsl.ProgramTree) Script {
+	d := &differ{a: index(a), b: index(b)}
+	d.treeDist = make([][]int, d.a.size()+1)
+	for i := range d.treeDist {
+		d.treeDist[i] = make([]int, d.b.size()+1)
+	}
+	for _, i := range d.a.keyroots {
+		for _, j := range d.b.keyroots {
+			d.forestDist(i, j, true)
+		}
+	}
+
+	s := Script{
+		Distance: d.treeDist[d.a.size()][d.b.size()],
+		old:      d.a,
+		new:      d.b,
+		mapping:  d.mapping(),
+	}
+	s.Edits = s.edits()
+	return s
+}
+
+func Distance(a, b *dsl.ProgramTree) int {
+	return Diff(a, b).Distance
+}
+
+func (s Script) edits() []Edit {
+	mapped := make(map[int]bool)
+	for _, j := range s.mapping {
+		mapped[j] = true
+	}
+	deleted := make(map[int]bool)
+	for i := 1; i <= s.old.size(); i++ {
+		if _, ok := s.mapping[i]; !ok {
+			deleted[i] = true
+		}
+	}
+	inserted := make(map[int]bool)
+	for j := 1; j <= s.new.size(); j++ {
+		if !mapped[j] {
+			inserted[j] = true
+		}
+	}
+
+	// a subtree deleted as a whole and inserted as a whole is a move
+	edits := make([]Edit, 0)
+	wholly := func(t *indexedTree, marks map[int]bool, root int) bool {
+		for k := t.leftmost[root]; k <= root; k++ {
+			if !marks[k] {
+				return false
+			}
+		}
+		return true
+	}
+	for i := s.old.size(); i >= 1; i-- {
+		if !deleted[i] || !wholly(s.old, deleted, i) {
+			continue
+		}
+		for j := s.new.size(); j >= 1; j-- {
+			if !inserted[j] || !wholly(s.new, inserted, j) || !dsl.Equal(s.old.nodes[i], s.new.nodes[j]) {
+				continue
+			}
+			edits = append(edits, Edit{
+				Kind: Move,
+				From: s.old.paths[i],
+				To:   s.new.paths[j],
+				Old:  s.old.nodes[i],
+				New:  s.new.nodes[j],
+			})
+			for k := s.old.leftmost[i]; k <= i; k++ {
+				delete(deleted, k)
+			}
+			for k := s.new.leftmost[j]; k <= j; k++ {
+				delete(inserted, k)
+			}
+			break
+		}
+	}
+
+	for i := 1; i <= s.old.size(); i++ {
+		a := s.old.nodes[i]
+		if deleted[i] {
+			edits = append(edits, Edit{Kind: Delete, From: s.old.paths[i], Old: a})
+			continue
+		}
+		j, ok := s.mapping[i]
+		if !ok {
+			continue
+		}
+		b := s.new.nodes[j]
+		e := Edit{From: s.old.paths[i], To: s.new.paths[j], Old: a, New: b}
+		if a.Symbol != b.Symbol {
+			e.Kind = Relabel
+			edits = append(edits, e)
+		} else if !dsl.EqualValue(valueOf(a), valueOf(b)) {
+			e.Kind = Update
+			edits = append(edits, e)
+		}
+	}
+	for j := 1; j <= s.new.size(); j++ {
+		if inserted[j] {
+			edits = append(edits, Edit{Kind: Insert, To: s.new.paths[j], New: s.new.nodes[j]})
+		}
+	}
+	return edits
+}
+
+// Unified renders both trees merged into one indented listing, marking
+// deleted nodes with '-', inserted nodes with '+' and changed nodes with '~'.
+func (s Script) Unified() string {
+	moves := make(map[string]Edit)
+	for _, e := range s.Edits {
+		if e.Kind == Move {
+			moves["-"+e.From.String()] = e
+			moves["+"+e.To.String()] = e
+		}
+	}
+	reverse := make(map[int]int)
+	for i, j := range s.mapping {
+		reverse[j] = i
+	}
+	oldOrder, newOrder := preOrder(s.old), preOrder(s.new)
+
+	var lines []string
+	emit := func(mark string, t *indexedTree, k int, text string) {
+		indent := strings.Repeat("  ", len(t.paths[k]))
+		if e, ok := moves[mark+t.paths[k].String()]; ok {
+			if mark == "-" {
+				text += fmt.Sprintf("  (moved to %v)", e.To)
+			} else {
+				text += fmt.Sprintf("  (moved from %v)", e.From)
+			}
+		}
+		lines = append(lines, mark+" "+indent+text)
+	}
+	x, y := 0, 0
+	for x < len(oldOrder) || y < len(newOrder) {
+		if x < len(oldOrder) {
+			if _, ok := s.mapping[oldOrder[x]]; !ok {
+				emit("-", s.old, oldOrder[x], label(s.old.nodes[oldOrder[x]]))
+				x++
+				continue
+			}
+		}
+		if y < len(newOrder) {
+			if _, ok := reverse[newOrder[y]]; !ok {
+				emit("+", s.new, newOrder[y], label(s.new.nodes[newOrder[y]]))
+				y++
+				continue
+			}
+		}
+		i, j := oldOrder[x], newOrder[y]
+		a, b := s.old.nodes[i], s.new.nodes[j]
+		if renameCost(a, b) == 0 {
+			emit(" ", s.new, j, label(b))
+		} else {
+			emit("~", s.new, j, label(a)+" -> "+label(b))
+		}
+		x++
+		y++
+	}
+	return strings.Join(lines, "\n")
+}
+
+func preOrder(t *indexedTree) []int {
+	byPath := make(map[string]int)
+	for k := 1; k <= t.size(); k++ {
+		byPath[t.paths[k].String()] = k
+	}
+	ret := make([]int, 0, t.size())
+	if t.size() == 0 {
+		return ret
+	}
+	for p := range t.nodes[t.size()].PreOrder() {
+		ret = append(ret, byPath[p.String()])
+	}
+	return ret
+}
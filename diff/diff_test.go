@@ -0,0 +1,140 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+var symbols = make(map[string]*dsl.Symbol)
+
+func node(id string, children ...*dsl.ProgramTree) *dsl.ProgramTree {
+	s, ok := symbols[id]
+	if !ok {
+		s = dsl.NewSymbol(id)
+		symbols[id] = s
+	}
+	n := dsl.NewProgramTree(s)
+	n.AddChildren(children...)
+	return n
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b *dsl.ProgramTree
+		want int
+	}{
+		{
+			name: "identical",
+			a:    node("f", node("a"), node("b")),
+			b:    node("f", node("a"), node("b")),
+			want: 0,
+		},
+		{
+			name: "relabel",
+			a:    node("f", node("a"), node("b")),
+			b:    node("f", node("a"), node("c")),
+			want: 1,
+		},
+		{
+			name: "value change",
+			a:    node("f", node("a").With(1)),
+			b:    node("f", node("a").With(2)),
+			want: 1,
+		},
+		{
+			name: "insert and delete",
+			a:    node("f", node("a"), node("b")),
+			b:    node("f", node("g", node("a")), node("b"), node("c")),
+			want: 2,
+		},
+		{
+			// the example of Zhang and Shasha
+			name: "paper",
+			a:    node("f", node("d", node("a"), node("c", node("b"))), node("e")),
+			b:    node("f", node("c", node("d", node("a"), node("b"))), node("e")),
+			want: 2,
+		},
+		{
+			name: "to a single node",
+			a:    node("f", node("a"), node("b", node("c"))),
+			b:    node("x"),
+			want: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Distance(tt.a, tt.b); got != tt.want {
+				t.Errorf("Distance() = %d, want %d", got, tt.want)
+			}
+			if got := Distance(tt.b, tt.a); got != tt.want {
+				t.Errorf("Distance() of the reverse = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiff_Edits(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b *dsl.ProgramTree
+		want []string
+	}{
+		{
+			name: "relabel and update",
+			a:    node("f", node("a").With(1), node("b")),
+			b:    node("f", node("a").With(2), node("c")),
+			want: []string{
+				`update "a"(1) to "a"(2) at /0`,
+				`relabel "b" to "c" at /1`,
+			},
+		},
+		{
+			name: "insert and delete",
+			a:    node("f", node("a"), node("b")),
+			b:    node("f", node("b"), node("c")),
+			want: []string{
+				`delete "a" at /0`,
+				`insert "c" at /1`,
+			},
+		},
+		{
+			name: "move",
+			a:    node("f", node("g", node("x"), node("y")), node("h")),
+			b:    node("f", node("h"), node("g", node("x"), node("y"))),
+			want: []string{
+				`move "h" from /1 to /0`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Diff(tt.a, tt.b)
+			got := make([]string, len(s.Edits))
+			for i, e := range s.Edits {
+				got[i] = e.String()
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Diff().Edits = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScript_Unified(t *testing.T) {
+	a := node("S", node("add", node("const").With(1), node("param").With(0)))
+	b := node("S", node("mult", node("const").With(2), node("param").With(0), node("const").With(3)))
+
+	want := strings.Join([]string{
+		`  "S"`,
+		`~   "add" -> "mult"`,
+		`~     "const"(1) -> "const"(2)`,
+		`      "param"(0)`,
+		`+     "const"(3)`,
+	}, "\n")
+	if got := Diff(a, b).Unified(); got != want {
+		t.Errorf("Script.Unified() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package dsl
+
+import "container/list"
+
+type cacheKey struct {
+	hash uint64
+	args uint64
+}
+
+type cacheEntry struct {
+	key    cacheKey
+	tree   *ProgramTree
+	args   []interface{}
+	result EvalResult
+}
+
+type CacheStats struct {
+	Hits      int
+	Misses    int
+	Evictions int
+}
+
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// EvalCache memoizes the results of pure evaluations of subtrees per
+// arguments, evicting the least recently used results beyond the capacity.
+type EvalCache struct {
+	capacity int
+	entries  map[cacheKey]*list.Element
+	order    *list.List
+	stats    CacheStats
+}
+
+func NewEvalCache(capacity int) *EvalCache {
+	return &EvalCache{
+		capacity: capacity,
+		entries:  make(map[cacheKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *EvalCache) get(t *ProgramTree, m *memo) (EvalResult, bool) {
+	elem, ok := c.entries[cacheKey{t.Hash(), m.args}]
+	if !ok || !Equal(elem.Value.(*cacheEntry).tree, t) || !equalArgs(elem.Value.(*cacheEntry).args, m.values) {
+		c.stats.Misses++
+		return EvalResult{}, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).result, true
+}
+
+// put caches the result unless it is an error, which may depend on the
+// budget or the root of the evaluation, or a closure, whose Env has them.
+func (c *EvalCache) put(t *ProgramTree, m *memo, result EvalResult) {
+	if _, ok := result.value.(*Closure); ok || result.err != nil || c.capacity <= 0 {
+		return
+	}
+	key := cacheKey{t.Hash(), m.args}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = &cacheEntry{key, t, m.values, result}
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key, t, m.values, result})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+func (c *EvalCache) Len() int {
+	return c.order.Len()
+}
+
+func (c *EvalCache) Stats() CacheStats {
+	return c.stats
+}
+
+func (c *EvalCache) Clear() {
+	c.entries = make(map[cacheKey]*list.Element)
+	c.order.Init()
+	c.stats = CacheStats{}
+}
+
+type memo struct {
+	cache  *EvalCache
+	values []interface{}
+	// args is the hash of the values
+	args uint64
+}
+
+// WithCache returns the Env whose pure evaluations are memoized in the cache
+// under its arguments, so the cache may be shared by Envs of any arguments.
+// The arguments added later are not in the key.
+func (e Env) WithCache(c *EvalCache) Env {
+	h := hashUint64(uint64(fnvOffset), uint64(len(e.args)))
+	for _, arg := range e.args {
+		h = hashValue(h, arg)
+	}
+	e.memo = &memo{cache: c, values: e.args, args: h}
+	return e
+}
+
+func equalArgs(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !EqualValue(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// cached evaluates the tree through the cache of the Env if any. The trees
+// evaluated with bindings are not cached since the key doesn't have them,
+// and neither are traced evaluations, so that the tracer sees every node.
+func (e Env) cached(t *ProgramTree, eval func() EvalResult) EvalResult {
+	if e.memo == nil || e.scope != nil || e.tracing != nil {
+		return eval()
+	}
+	if ret, ok := e.memo.cache.get(t, e.memo); ok {
+		return ret
+	}
+	ret := eval()
+	e.memo.cache.put(t, e.memo, ret)
+	return ret
+}
@@ -0,0 +1,105 @@
+package dsl
+
+import "testing"
+
+func TestEvalCache(t *testing.T) {
+	g := newExpGrammar()
+	calls := 0
+	evaluator := NewSemantics(&g.gram).
+		Register(g.plus, Binary(func(a, b int) int { calls++; return a + b })).
+		Register(g.mult, Binary(func(a, b int) int { calls++; return a * b })).
+		RegisterLeaf(g.cnst, Constant).
+		RegisterLeaf(g.param, Argument).
+		MarkPure().
+		Evaluator()
+
+	shared := g.node(g.mult, g.leaf(g.param, 0), g.leaf(g.cnst, 3))
+	// (x0*3)+(x0*3) and its equal copy, sharing no pointers
+	first := g.node(g.plus, shared, shared.Clone())
+	second := first.Clone()
+
+	tests := []struct {
+		name      string
+		pgm       *PGM
+		args      []interface{}
+		want      int
+		wantCalls int
+	}{
+		{name: "shared subtree", pgm: first, args: []interface{}{2}, want: 12, wantCalls: 2},
+		{name: "equal tree", pgm: second, args: []interface{}{2}, want: 12, wantCalls: 0},
+		{name: "other arguments", pgm: second, args: []interface{}{5}, want: 30, wantCalls: 2},
+		{name: "same arguments again", pgm: first, args: []interface{}{2}, want: 12, wantCalls: 0},
+	}
+
+	cache := NewEvalCache(100)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			got, _ := evaluator.Eval(tt.pgm, NewEnv(tt.args...).WithCache(cache)).Value()
+			if got != tt.want {
+				t.Errorf("Evaluator.Eval() = %v, want %v", got, tt.want)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("semantics called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+	if stats := cache.Stats(); stats.Hits == 0 || stats.HitRate() <= 0 || stats.HitRate() >= 1 {
+		t.Errorf("EvalCache.Stats() = %+v", stats)
+	}
+
+	t.Run("compiled", func(t *testing.T) {
+		calls = 0
+		got, _ := evaluator.Compile(first).Run(NewEnv(5).WithCache(cache)).Value()
+		if got != 30 || calls != 0 {
+			t.Errorf("Program.Run() = %v with %d calls, want %v with %d calls", got, calls, 30, 0)
+		}
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		before := cache.Len()
+		evaluator.Eval(first, NewEnv().WithCache(cache))
+		if cache.Len() != before {
+			t.Errorf("EvalCache.Len() = %d, want %d", cache.Len(), before)
+		}
+	})
+}
+
+func TestEvalCache_Eviction(t *testing.T) {
+	g := newExpGrammar()
+	calls := 0
+	evaluator := NewPureEvaluator(func(n *PGM, env Env) EvalResult {
+		calls++
+		return NewEvalResult(n.value)
+	})
+
+	cache := NewEvalCache(2)
+	eval := func(v int) {
+		evaluator.Eval(&PGM{Symbol: g.cnst, value: v}, NewEnv().WithCache(cache))
+	}
+	eval(1)
+	eval(2)
+	eval(1) // 2 is the least recently used
+	eval(3)
+	calls = 0
+	eval(1)
+	if calls != 0 {
+		t.Errorf("a recently used result is evicted")
+	}
+	eval(2)
+	if calls != 1 {
+		t.Errorf("the least recently used result is not evicted")
+	}
+
+	want := CacheStats{Hits: 2, Misses: 4, Evictions: 2}
+	if got := cache.Stats(); got != want {
+		t.Errorf("EvalCache.Stats() = %+v, want %+v", got, want)
+	}
+	if got := cache.Len(); got != 2 {
+		t.Errorf("EvalCache.Len() = %d, want %d", got, 2)
+	}
+	cache.Clear()
+	if got := cache.Stats(); got != (CacheStats{}) || cache.Len() != 0 {
+		t.Errorf("EvalCache.Clear() leaves %+v", got)
+	}
+}
@@ -0,0 +1,107 @@
+package dsl
+
+// Program is a tree compiled for repeated evaluation.
+type Program struct {
+	root *ProgramTree
+	run  func(Env) EvalResult
+}
+
+func (p *Program) Run(env Env) EvalResult {
+	return run(p.root, func() EvalResult {
+		return p.run(env)
+	})
+}
+
+// Compile compiles the tree into nested closures if the evaluator is built
+// by Semantics, and wraps Eval otherwise, with the cache of a pure
+// evaluator.
+func (e *Evaluator) Compile(ast *ProgramTree) *Program {
+	if e.compileFunc == nil {
+		return &Program{root: ast, run: func(env Env) EvalResult {
+			if e.pure {
+				return env.cached(ast, func() EvalResult {
+					return e.evalFunc(ast, env)
+				})
+			}
+			return e.evalFunc(ast, env)
+		}}
+	}
+	return &Program{root: ast, run: e.compileFunc(ast)}
+}
+
+// compile resolves the semantics of every node once, so that running the
+// closure doesn't look up the registry.
+func (s *Semantics) compile(node *ProgramTree) func(Env) EvalResult {
+	eval := s.compileNode(node)
+	step := func(env Env) EvalResult {
+		if err := env.Enter(node); err != nil {
+			return NewEvalErrorResult(err)
+		}
+		ret := eval(env)
+		env.Leave(node, ret)
+		return ret
+	}
+	if !s.pure {
+		return step
+	}
+	return func(env Env) EvalResult {
+		return env.cached(node, func() EvalResult {
+			return step(env)
+		})
+	}
+}
+
+func (s *Semantics) compileNode(node *ProgramTree) func(Env) EvalResult {
+	if f, ok := s.leaves[node.Symbol]; ok {
+		result := s.result(node)
+		return func(env Env) EvalResult {
+			return result(f(node, env))
+		}
+	}
+	if len(node.Children) == 0 && !node.Symbol.IsTerminal() {
+		return func(Env) EvalResult {
+			return NewEvalResult(nil)
+		}
+	}
+	children := make([]func(Env) EvalResult, len(node.Children))
+	if form, ok := s.forms[node.Symbol]; ok {
+		for i, c := range node.Children {
+			children[i] = s.compile(c)
+		}
+		eval := func(i int, env Env) EvalResult {
+			return children[i](env.Child(i))
+		}
+		return func(env Env) EvalResult {
+			return form(node, env, eval)
+		}
+	}
+	f, ok := s.funcs[node.Symbol]
+	if !ok && len(node.Children) != 1 {
+		err := NewEvalErrorResult(NewEvalError(Failure, node, "no semantics for %s", node.Symbol))
+		return func(Env) EvalResult {
+			return err
+		}
+	}
+	if !ok {
+		child := s.compile(node.Children[0])
+		return func(env Env) EvalResult {
+			return child(env.Child(0))
+		}
+	}
+
+	for i, c := range node.Children {
+		children[i] = s.compile(c)
+	}
+	result := s.result(node)
+	return func(env Env) EvalResult {
+		args := make([]Value, len(children))
+		for i, c := range children {
+			r := c(env.Child(i))
+			if r.err != nil || r.value == nil {
+				return r
+			}
+			args[i] = r.value
+		}
+		return result(f(args...))
+	}
+}
@@ -0,0 +1,83 @@
+package dsl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func (g expGrammar) evaluator() Evaluator {
+	return NewSemantics(&g.gram).
+		Register(g.plus, Binary(func(a, b int) int { return a + b })).
+		Register(g.minus, Binary(func(a, b int) int { return a - b })).
+		Register(g.mult, Binary(func(a, b int) int { return a * b })).
+		RegisterLeaf(g.cnst, Constant).
+		RegisterLeaf(g.param, Argument).
+		Evaluator()
+}
+
+func (g expGrammar) node(s *Symbol, children ...*PGM) *PGM {
+	return &PGM{Symbol: g.exp, Children: []*PGM{&PGM{Symbol: s, Children: children}}}
+}
+
+func (g expGrammar) leaf(s *Symbol, value int) *PGM {
+	return &PGM{Symbol: g.exp, Children: []*PGM{&PGM{Symbol: s, value: value}}}
+}
+
+// polynomial returns x0*(x0*(...(x0+c)...)+c)+c of the degree.
+func (g expGrammar) polynomial(degree int) *PGM {
+	tree := g.leaf(g.cnst, 1)
+	for i := 0; i < degree; i++ {
+		tree = g.node(g.plus, g.node(g.mult, g.leaf(g.param, 0), tree), g.leaf(g.cnst, i))
+	}
+	return &PGM{Symbol: g.S, Children: []*PGM{tree}}
+}
+
+func TestEvaluator_Compile(t *testing.T) {
+	g := newExpGrammar()
+	evaluator := g.evaluator()
+	untyped := NewEvaluator(evaluator.evalFunc)
+
+	tests := []struct {
+		name string
+		pgm  *PGM
+		env  Env
+	}{
+		{name: "polynomial", pgm: g.polynomial(5), env: NewEnv(3)},
+		{name: "hole", pgm: g.node(g.plus, &PGM{Symbol: g.exp}, g.leaf(g.cnst, 1)), env: NewEnv()},
+		{name: "missing argument", pgm: g.polynomial(2), env: NewEnv()},
+		{name: "missing value", pgm: g.node(g.plus, g.leaf(g.cnst, 1), g.node(g.cnst)), env: NewEnv()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := evaluator.Eval(tt.pgm, tt.env)
+			if got := evaluator.Compile(tt.pgm).Run(tt.env); !reflect.DeepEqual(got, want) {
+				t.Errorf("Program.Run() = %v, want %v", got, want)
+			}
+			if got := untyped.Compile(tt.pgm).Run(tt.env); !reflect.DeepEqual(got, want) {
+				t.Errorf("Program.Run() without compiler = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func BenchmarkEvaluator_Eval(b *testing.B) {
+	g := newExpGrammar()
+	evaluator := g.evaluator()
+	pgm := g.polynomial(20)
+	env := NewEnv(2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		evaluator.Eval(pgm, env)
+	}
+}
+
+func BenchmarkProgram_Run(b *testing.B) {
+	g := newExpGrammar()
+	evaluator := g.evaluator()
+	program := evaluator.Compile(g.polynomial(20))
+	env := NewEnv(2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		program.Run(env)
+	}
+}
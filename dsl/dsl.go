@@ -1,8 +1,8 @@
 package dsl
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"strings"
 )
 
@@ -56,6 +56,64 @@ func (g *Grammar) GetStart() *Symbol {
 	return g.start
 }
 
+func (g *Grammar) GetSymbol(id string) (*Symbol, bool) {
+	if g.start.Id == id {
+		return g.start, true
+	}
+	s, ok := g.symbols.ids[id]
+	return s, ok
+}
+
+// Validate checks the tree against the rules, without recursion so that
+// deep trees don't overflow the stack.
+func (g *Grammar) Validate(t *ProgramTree) error {
+	stack := []*ProgramTree{t}
+	for len(stack) > 0 {
+		t := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		s, ok := g.GetSymbol(t.Symbol.Id)
+		if !ok || s != t.Symbol {
+			return fmt.Errorf("unknown symbol %s", t.Symbol)
+		}
+		if len(t.Children) == 0 {
+			continue
+		}
+		if s.IsTerminal() {
+			return fmt.Errorf("terminal symbol %s has children", s)
+		}
+		if !g.hasProduction(s, t.Children) {
+			ids := make([]string, len(t.Children))
+			for i, c := range t.Children {
+				ids[i] = c.Symbol.Id
+			}
+			return fmt.Errorf("no rule of %s matches the children %v", s, ids)
+		}
+		for i := len(t.Children) - 1; i >= 0; i-- {
+			stack = append(stack, t.Children[i])
+		}
+	}
+	return nil
+}
+
+func (g *Grammar) hasProduction(left *Symbol, children []*ProgramTree) bool {
+	for _, seq := range g.GetRhs(left) {
+		if len(seq) != len(children) {
+			continue
+		}
+		match := true
+		for i, s := range seq {
+			if children[i].Symbol != s {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
 func (g *Grammar) AddRule(left *Symbol, right ...*Symbol) {
 	g.symbols.addSymbol(left)
 	for _, r := range right {
@@ -76,16 +134,19 @@ func (g Grammar) String() string {
 
 type symbolSet struct {
 	symbols map[*Symbol]struct{}
+	ids     map[string]*Symbol
 }
 
 func newSymbols() symbolSet {
 	return symbolSet{
 		symbols: make(map[*Symbol]struct{}),
+		ids:     make(map[string]*Symbol),
 	}
 }
 
 func (ss *symbolSet) addSymbol(s *Symbol) {
 	ss.symbols[s] = struct{}{}
+	ss.ids[s.Id] = s
 }
 
 func (ss symbolSet) String() string {
@@ -198,6 +259,13 @@ type ProgramTree struct {
 	Symbol   *Symbol
 	Children []*ProgramTree
 	value    interface{}
+	hash     uint64
+	hashed   bool
+	metrics  metrics
+	measured bool
+	// frozen marks the nodes of a forest, the only ones caching their hash
+	// and metrics since they are never modified.
+	frozen bool
 }
 
 func NewProgramTree(s *Symbol) *ProgramTree {
@@ -225,14 +293,13 @@ func (n *ProgramTree) Value() (interface{}, bool) {
 }
 
 func (n *ProgramTree) Leaves() []*ProgramTree {
-	if len(n.Children) == 0 {
-		return []*ProgramTree{n}
-	}
 	ret := make([]*ProgramTree, 0)
-	for _, c := range n.Children {
-		leaves := c.Leaves()
-		ret = append(ret, leaves...)
-	}
+	Walk(VisitorFuncs{EnterFunc: func(_ Path, c *ProgramTree) Action {
+		if len(c.Children) == 0 {
+			ret = append(ret, c)
+		}
+		return Continue
+	}}, n)
 	return ret
 }
 
@@ -247,33 +314,24 @@ func (n *ProgramTree) NonTerminalLeaves() []*ProgramTree {
 }
 
 func (n *ProgramTree) Clone() *ProgramTree {
-	// shallow copy
-	thisCpy := NewProgramTree(n.Symbol)
-	thisCpy.value = n.value
-
-	// deep copy
-	for _, c := range n.Children {
-		childCpy := c.Clone()
-		thisCpy.AddChildren(childCpy)
-	}
-	return thisCpy
+	return Map(n, func(c *ProgramTree) *ProgramTree {
+		return c
+	})
 }
 
 func (n *ProgramTree) String() string {
-	var symbolStr string
-	if val, ok := n.Value(); ok {
-		symbolStr = fmt.Sprintf("%s(%v)", n.Symbol.String(), val)
-	} else {
-		symbolStr = n.Symbol.String()
-	}
-	if n.Children == nil || len(n.Children) == 0 {
-		return symbolStr
-	}
-	childStrs := make([]string, len(n.Children))
-	for i, c := range n.Children {
-		childStrs[i] = c.String()
-	}
-	return symbolStr + "[" + strings.Join(childStrs, ",") + "]"
+	return Fold(n, func(c *ProgramTree, childStrs []string) string {
+		var symbolStr string
+		if val, ok := c.Value(); ok {
+			symbolStr = fmt.Sprintf("%s(%v)", c.Symbol.String(), val)
+		} else {
+			symbolStr = c.Symbol.String()
+		}
+		if len(childStrs) == 0 {
+			return symbolStr
+		}
+		return symbolStr + "[" + strings.Join(childStrs, ",") + "]"
+	})
 }
 
 func (n *ProgramTree) FormattedString() string {
@@ -311,6 +369,11 @@ func (n *ProgramTree) FormattedString() string {
 
 type Evaluator struct {
 	evalFunc func(*ProgramTree, Env) EvalResult
+	// compileFunc is set by the evaluators that can compile trees.
+	compileFunc func(*ProgramTree) func(Env) EvalResult
+	// pure is set by the evaluators whose results depend only on the tree
+	// and the arguments, which are memoized by the cache of the Env.
+	pure bool
 }
 
 func NewEvaluator(eval func(*ProgramTree, Env) EvalResult) Evaluator {
@@ -319,12 +382,49 @@ func NewEvaluator(eval func(*ProgramTree, Env) EvalResult) Evaluator {
 	}
 }
 
+// Eval evaluates the tree, where an *EvalError panicked by the evaluation,
+// like the one of Env.GetArg, results in the error.
 func (e *Evaluator) Eval(ast *ProgramTree, env Env) EvalResult {
-	return e.evalFunc(ast, env)
+	return run(ast, func() EvalResult {
+		if e.pure {
+			return env.cached(ast, func() EvalResult {
+				return e.evalFunc(ast, env)
+			})
+		}
+		return e.evalFunc(ast, env)
+	})
+}
+
+// NewPureEvaluator returns the Evaluator whose results are memoized by the
+// cache of the Env, for the evaluation function depending only on the tree
+// and the arguments.
+func NewPureEvaluator(eval func(*ProgramTree, Env) EvalResult) Evaluator {
+	e := NewEvaluator(eval)
+	e.pure = true
+	return e
+}
+
+func run(root *ProgramTree, eval func() EvalResult) (ret EvalResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(*EvalError)
+			if !ok {
+				panic(r)
+			}
+			ret = NewEvalErrorResult(err.locate(root))
+		}
+	}()
+	ret = eval()
+	var evalErr *EvalError
+	if errors.As(ret.err, &evalErr) && evalErr.Path == nil {
+		ret.err = evalErr.locate(root)
+	}
+	return ret
 }
 
 type EvalResult struct {
 	value interface{}
+	err   error
 }
 
 func NewEvalResult(value interface{}) EvalResult {
@@ -333,15 +433,32 @@ func NewEvalResult(value interface{}) EvalResult {
 	}
 }
 
+func NewEvalErrorResult(err error) EvalResult {
+	return EvalResult{
+		err: err,
+	}
+}
+
 func (e EvalResult) Value() (interface{}, bool) {
-	if e.value != nil {
+	if e.value != nil && e.err == nil {
 		return e.value, true
 	}
 	return nil, false
 }
 
+func (e EvalResult) Err() error {
+	return e.err
+}
+
 type Env struct {
-	args []interface{}
+	args    []interface{}
+	budget  *budget
+	tracing *tracing
+	memo    *memo
+	scope   *scope
+	// child is one more than the index of the node evaluated in the Env
+	// among the children of its parent, or zero if unknown
+	child int
 }
 
 func NewEnv(args ...interface{}) Env {
@@ -354,9 +471,24 @@ func (e *Env) AddArgs(args ...interface{}) {
 	e.args = append(e.args, args...)
 }
 
+func (e *Env) Arg(i int) (interface{}, error) {
+	if i < 0 || i >= len(e.args) {
+		return nil, NewEvalError(ArgOutOfRange, nil, "no argument %d in %d arguments", i, len(e.args))
+	}
+	return e.args[i], nil
+}
+
+func (e *Env) ArgCount() int {
+	return len(e.args)
+}
+
+// GetArg is Arg that panics with the error, which Evaluator.Eval and
+// Program.Run turn into the result. It is only for the semantics called
+// inside an evaluation, and other callers must use Arg.
 func (e *Env) GetArg(i int) interface{} {
-	if i >= len(e.args) {
-		log.Fatal("invalid index of args in Environment")
+	arg, err := e.Arg(i)
+	if err != nil {
+		panic(err)
 	}
-	return e.args[i]
+	return arg
 }
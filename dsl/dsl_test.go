@@ -1,7 +1,6 @@
 package dsl
 
 import (
-	"log"
 	"reflect"
 	"testing"
 )
@@ -104,68 +103,24 @@ func TestEvaluator_Eval_Exp(t *testing.T) {
 	cnst := NewSymbol("const")
 	param := NewSymbol("param")
 
-	var eval func(*ProgramTree, Env) EvalResult
-	eval = func(node *ProgramTree, env Env) EvalResult {
-		var ret EvalResult
-		switch node.Symbol {
-		case plus:
-			e1, ok := eval(node.Children[0], env).Value()
-			if !ok {
-				return NewEvalResult(nil)
-			}
-			e2, ok := eval(node.Children[1], env).Value()
-			if !ok {
-				return NewEvalResult(nil)
-			}
-			v1 := e1.(int)
-			v2 := e2.(int)
-			ret = NewEvalResult(v1 + v2)
-		case minus:
-			e1, ok := eval(node.Children[0], env).Value()
-			if !ok {
-				return NewEvalResult(nil)
-			}
-			e2, ok := eval(node.Children[1], env).Value()
-			if !ok {
-				return NewEvalResult(nil)
-			}
-			v1 := e1.(int)
-			v2 := e2.(int)
-			ret = NewEvalResult(v1 - v2)
-		case mult:
-			e1, ok := eval(node.Children[0], env).Value()
-			if !ok {
-				return NewEvalResult(nil)
-			}
-			e2, ok := eval(node.Children[1], env).Value()
-			if !ok {
-				return NewEvalResult(nil)
-			}
-			v1 := e1.(int)
-			v2 := e2.(int)
-			ret = NewEvalResult(v1 * v2)
-		case cnst:
-			val, err := node.Value()
-			if !err {
-				log.Fatal("the const doesn't hava the value")
-			}
-			ret = NewEvalResult(val)
-		case param:
-			i, err := node.Value()
-			if !err {
-				log.Fatal("the const doesn't hava the value")
-			}
-			ret = NewEvalResult(env.GetArg(i.(int)))
-		default:
-			// S, exp,
-			if len(node.Children) == 0 {
-				return NewEvalResult(nil)
-			}
-			ret = eval(node.Children[0], env)
-		}
-		return ret
-	}
-	evaluator := NewEvaluator(eval)
+	gram := NewGrammar(S)
+	gram.AddRule(S, exp)
+	gram.AddRule(exp, plus)
+	gram.AddRule(exp, minus)
+	gram.AddRule(exp, mult)
+	gram.AddRule(exp, cnst)
+	gram.AddRule(exp, param)
+	gram.AddRule(plus, exp, exp)
+	gram.AddRule(minus, exp, exp)
+	gram.AddRule(mult, exp, exp)
+
+	evaluator := NewSemantics(&gram).
+		Register(plus, Binary(func(a, b int) int { return a + b })).
+		Register(minus, Binary(func(a, b int) int { return a - b })).
+		Register(mult, Binary(func(a, b int) int { return a * b })).
+		RegisterLeaf(cnst, Constant).
+		RegisterLeaf(param, Argument).
+		Evaluator()
 
 	type args struct {
 		env Env
@@ -319,6 +274,47 @@ func TestEvaluator_Eval_Exp(t *testing.T) {
 			}
 		})
 	}
+
+	errTests := []struct {
+		name     string
+		env      Env
+		pgm      *PGM
+		wantKind ErrorKind
+		wantPath string
+	}{
+		{
+			name:     "param(2) with Env[100]",
+			env:      NewEnv(100),
+			pgm:      &PGM{Symbol: param, value: 2},
+			wantKind: ArgOutOfRange,
+		},
+		{
+			name: "const without value",
+			env:  NewEnv(),
+			pgm: &PGM{
+				Symbol: plus, Children: []*PGM{
+					&PGM{Symbol: cnst, value: 1},
+					&PGM{Symbol: cnst},
+				},
+			},
+			wantKind: MissingValue,
+			wantPath: "/1",
+		},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := evaluator.Eval(tt.pgm, tt.env)
+			if _, ok := got.Value(); ok || !IsKind(got.Err(), tt.wantKind) {
+				t.Fatalf("Evaluator.Eval() = %v, want an error of %v", got, tt.wantKind)
+			}
+			if tt.wantPath == "" {
+				return
+			}
+			if path := got.Err().(*EvalError).Path.String(); path != tt.wantPath {
+				t.Errorf("EvalError.Path = %v, want %v", path, tt.wantPath)
+			}
+		})
+	}
 }
 
 func TestProgramTree_Clone(t *testing.T) {
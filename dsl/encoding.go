@@ -0,0 +1,510 @@
+package dsl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+const maxMessageSize = 64 << 20
+
+// maxTreeDepth bounds the nesting of decoded trees, which are decoded
+// recursively, like encoding/json bounds the nesting of values.
+const maxTreeDepth = 10000
+
+type ValueRegistry struct {
+	byName map[string]*valueType
+	byType map[reflect.Type]*valueType
+}
+
+type valueType struct {
+	name   string
+	typ    reflect.Type
+	encode func(interface{}) ([]byte, error)
+	decode func([]byte) (interface{}, error)
+}
+
+func NewValueRegistry() *ValueRegistry {
+	r := &ValueRegistry{
+		byName: make(map[string]*valueType),
+		byType: make(map[reflect.Type]*valueType),
+	}
+	r.RegisterCodec("int", 0, encodeInt, decodeInt)
+	r.RegisterCodec("int64", int64(0), encodeInt64, decodeInt64)
+	r.RegisterCodec("float64", float64(0), encodeFloat64, decodeFloat64)
+	r.RegisterCodec("string", "", encodeString, decodeString)
+	r.RegisterCodec("bool", false, encodeBool, decodeBool)
+	return r
+}
+
+// Register adds a custom value type which is encoded as JSON in both formats.
+func (r *ValueRegistry) Register(name string, sample interface{}) {
+	typ := reflect.TypeOf(sample)
+	r.RegisterCodec(name, sample,
+		func(v interface{}) ([]byte, error) {
+			return json.Marshal(v)
+		},
+		func(data []byte) (interface{}, error) {
+			return unmarshalAs(typ, data)
+		})
+}
+
+// RegisterCodec adds a custom value type with its own binary encoding.
+func (r *ValueRegistry) RegisterCodec(name string, sample interface{},
+	encode func(interface{}) ([]byte, error), decode func([]byte) (interface{}, error)) {
+	vt := &valueType{
+		name:   name,
+		typ:    reflect.TypeOf(sample),
+		encode: encode,
+		decode: decode,
+	}
+	r.byName[name] = vt
+	r.byType[vt.typ] = vt
+}
+
+func (r *ValueRegistry) typeOf(v interface{}) (*valueType, error) {
+	vt, ok := r.byType[reflect.TypeOf(v)]
+	if !ok {
+		return nil, fmt.Errorf("unregistered value type %T", v)
+	}
+	return vt, nil
+}
+
+func (r *ValueRegistry) typeNamed(name string) (*valueType, error) {
+	vt, ok := r.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unregistered value type %q", name)
+	}
+	return vt, nil
+}
+
+func unmarshalAs(typ reflect.Type, data []byte) (interface{}, error) {
+	ptr := reflect.New(typ)
+	if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+type Codec struct {
+	grammar *Grammar
+	values  *ValueRegistry
+}
+
+func NewCodec(grammar *Grammar, values *ValueRegistry) Codec {
+	if values == nil {
+		values = NewValueRegistry()
+	}
+	return Codec{
+		grammar: grammar,
+		values:  values,
+	}
+}
+
+type jsonTree struct {
+	Symbol   string      `json:"symbol"`
+	Value    *jsonValue  `json:"value,omitempty"`
+	Children []*jsonTree `json:"children,omitempty"`
+}
+
+type jsonValue struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+func (c Codec) EncodeJSON(t *ProgramTree) ([]byte, error) {
+	jt, err := c.toJSONTree(t)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jt)
+}
+
+func (c Codec) toJSONTree(t *ProgramTree) (*jsonTree, error) {
+	jt := &jsonTree{Symbol: t.Symbol.Id}
+	if val, ok := t.Value(); ok {
+		vt, err := c.values.typeOf(val)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(val)
+		if err != nil {
+			return nil, err
+		}
+		jt.Value = &jsonValue{Type: vt.name, Data: data}
+	}
+	for _, child := range t.Children {
+		jc, err := c.toJSONTree(child)
+		if err != nil {
+			return nil, err
+		}
+		jt.Children = append(jt.Children, jc)
+	}
+	return jt, nil
+}
+
+func (c Codec) DecodeJSON(data []byte) (*ProgramTree, error) {
+	var jt jsonTree
+	if err := json.Unmarshal(data, &jt); err != nil {
+		return nil, err
+	}
+	t, err := c.fromJSONTree(&jt, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.grammar.Validate(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (c Codec) fromJSONTree(jt *jsonTree, depth int) (*ProgramTree, error) {
+	if depth > maxTreeDepth {
+		return nil, fmt.Errorf("tree deeper than %d", maxTreeDepth)
+	}
+	s, ok := c.grammar.GetSymbol(jt.Symbol)
+	if !ok {
+		return nil, fmt.Errorf("unknown symbol %q", jt.Symbol)
+	}
+	t := NewProgramTree(s)
+	if jt.Value != nil {
+		vt, err := c.values.typeNamed(jt.Value.Type)
+		if err != nil {
+			return nil, err
+		}
+		val, err := unmarshalAs(vt.typ, jt.Value.Data)
+		if err != nil {
+			return nil, err
+		}
+		t.With(val)
+	}
+	for _, jc := range jt.Children {
+		child, err := c.fromJSONTree(jc, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		t.AddChildren(child)
+	}
+	return t, nil
+}
+
+// The binary format is a stream of messages, each holding one tree and
+// prefixed by its length as a uvarint. Symbols and value types are written
+// in full on their first use within a message and referenced by index after.
+func (c Codec) EncodeBinary(t *ProgramTree) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.NewEncoder(&buf).Encode(t); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c Codec) DecodeBinary(data []byte) (*ProgramTree, error) {
+	dec := c.NewDecoder(bytes.NewReader(data))
+	t, err := dec.Decode()
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if _, err := dec.r.ReadByte(); err != io.EOF {
+		return nil, errors.New("trailing data after the tree")
+	}
+	return t, nil
+}
+
+type TreeEncoder struct {
+	codec Codec
+	w     io.Writer
+}
+
+func (c Codec) NewEncoder(w io.Writer) *TreeEncoder {
+	return &TreeEncoder{
+		codec: c,
+		w:     w,
+	}
+}
+
+func (e *TreeEncoder) Encode(t *ProgramTree) error {
+	m := &messageWriter{
+		values:  e.codec.values,
+		symbols: make(map[*Symbol]uint64),
+		types:   make(map[*valueType]uint64),
+	}
+	if err := m.writeTree(t); err != nil {
+		return err
+	}
+	msg := binary.AppendUvarint(nil, uint64(len(m.buf)))
+	msg = append(msg, m.buf...)
+	_, err := e.w.Write(msg)
+	return err
+}
+
+type messageWriter struct {
+	buf     []byte
+	values  *ValueRegistry
+	symbols map[*Symbol]uint64
+	types   map[*valueType]uint64
+}
+
+func (m *messageWriter) writeBytes(b []byte) {
+	m.buf = binary.AppendUvarint(m.buf, uint64(len(b)))
+	m.buf = append(m.buf, b...)
+}
+
+func (m *messageWriter) writeTree(t *ProgramTree) error {
+	if idx, ok := m.symbols[t.Symbol]; ok {
+		m.buf = binary.AppendUvarint(m.buf, idx+1)
+	} else {
+		m.symbols[t.Symbol] = uint64(len(m.symbols))
+		m.buf = binary.AppendUvarint(m.buf, 0)
+		m.writeBytes([]byte(t.Symbol.Id))
+	}
+
+	if val, ok := t.Value(); ok {
+		vt, err := m.values.typeOf(val)
+		if err != nil {
+			return err
+		}
+		if idx, ok := m.types[vt]; ok {
+			m.buf = binary.AppendUvarint(m.buf, idx+2)
+		} else {
+			m.types[vt] = uint64(len(m.types))
+			m.buf = binary.AppendUvarint(m.buf, 1)
+			m.writeBytes([]byte(vt.name))
+		}
+		data, err := vt.encode(val)
+		if err != nil {
+			return err
+		}
+		m.writeBytes(data)
+	} else {
+		m.buf = binary.AppendUvarint(m.buf, 0)
+	}
+
+	m.buf = binary.AppendUvarint(m.buf, uint64(len(t.Children)))
+	for _, c := range t.Children {
+		if err := m.writeTree(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type TreeDecoder struct {
+	codec Codec
+	r     *bufio.Reader
+}
+
+func (c Codec) NewDecoder(r io.Reader) *TreeDecoder {
+	return &TreeDecoder{
+		codec: c,
+		r:     bufio.NewReader(r),
+	}
+}
+
+// Decode reads the next tree of the stream. It returns io.EOF when the
+// stream ends cleanly between two messages.
+func (d *TreeDecoder) Decode() (*ProgramTree, error) {
+	size, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the limit", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	m := &messageReader{
+		r:       bytes.NewReader(buf),
+		grammar: d.codec.grammar,
+		values:  d.codec.values,
+	}
+	t, err := m.readTree(1)
+	if err != nil {
+		return nil, err
+	}
+	if m.r.Len() != 0 {
+		return nil, errors.New("trailing data in the message")
+	}
+	if err := d.codec.grammar.Validate(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+type messageReader struct {
+	r       *bytes.Reader
+	grammar *Grammar
+	values  *ValueRegistry
+	symbols []*Symbol
+	types   []*valueType
+}
+
+func (m *messageReader) readUvarint() (uint64, error) {
+	v, err := binary.ReadUvarint(m.r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return v, err
+}
+
+func (m *messageReader) readBytes() ([]byte, error) {
+	size, err := m.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if size > uint64(m.r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, size)
+	_, err = io.ReadFull(m.r, b)
+	return b, err
+}
+
+func (m *messageReader) readTree(depth int) (*ProgramTree, error) {
+	if depth > maxTreeDepth {
+		return nil, fmt.Errorf("tree deeper than %d", maxTreeDepth)
+	}
+	ref, err := m.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	var s *Symbol
+	if ref == 0 {
+		id, err := m.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if s, ok = m.grammar.GetSymbol(string(id)); !ok {
+			return nil, fmt.Errorf("unknown symbol %q", id)
+		}
+		m.symbols = append(m.symbols, s)
+	} else {
+		if ref > uint64(len(m.symbols)) {
+			return nil, fmt.Errorf("invalid symbol reference %d", ref)
+		}
+		s = m.symbols[ref-1]
+	}
+	t := NewProgramTree(s)
+
+	ref, err = m.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if ref != 0 {
+		var vt *valueType
+		if ref == 1 {
+			name, err := m.readBytes()
+			if err != nil {
+				return nil, err
+			}
+			if vt, err = m.values.typeNamed(string(name)); err != nil {
+				return nil, err
+			}
+			m.types = append(m.types, vt)
+		} else {
+			if ref-2 >= uint64(len(m.types)) {
+				return nil, fmt.Errorf("invalid value type reference %d", ref)
+			}
+			vt = m.types[ref-2]
+		}
+		data, err := m.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		val, err := vt.decode(data)
+		if err != nil {
+			return nil, err
+		}
+		t.With(val)
+	}
+
+	n, err := m.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	// every child takes at least three bytes
+	if n > uint64(m.r.Len())/3 {
+		return nil, fmt.Errorf("invalid number of children %d", n)
+	}
+	for i := uint64(0); i < n; i++ {
+		c, err := m.readTree(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		t.AddChildren(c)
+	}
+	return t, nil
+}
+
+func encodeInt(v interface{}) ([]byte, error) {
+	return binary.AppendVarint(nil, int64(v.(int))), nil
+}
+
+func decodeInt(data []byte) (interface{}, error) {
+	v, err := decodeInt64(data)
+	if err != nil {
+		return nil, err
+	}
+	return int(v.(int64)), nil
+}
+
+func encodeInt64(v interface{}) ([]byte, error) {
+	return binary.AppendVarint(nil, v.(int64)), nil
+}
+
+func decodeInt64(data []byte) (interface{}, error) {
+	v, n := binary.Varint(data)
+	if n <= 0 || n != len(data) {
+		return nil, errors.New("malformed integer value")
+	}
+	return v, nil
+}
+
+func encodeFloat64(v interface{}) ([]byte, error) {
+	return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v.(float64))), nil
+}
+
+func decodeFloat64(data []byte) (interface{}, error) {
+	if len(data) != 8 {
+		return nil, errors.New("malformed float value")
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(data)), nil
+}
+
+func encodeString(v interface{}) ([]byte, error) {
+	return []byte(v.(string)), nil
+}
+
+func decodeString(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+func encodeBool(v interface{}) ([]byte, error) {
+	if v.(bool) {
+		return []byte{1}, nil
+	}
+	return []byte{0}, nil
+}
+
+func decodeBool(data []byte) (interface{}, error) {
+	if len(data) != 1 || data[0] > 1 {
+		return nil, errors.New("malformed bool value")
+	}
+	return data[0] == 1, nil
+}
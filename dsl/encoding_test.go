@@ -0,0 +1,246 @@
+package dsl
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+type expGrammar struct {
+	gram                                           Grammar
+	S, exp, plus, minus, mult, cnst, param, let, v *Symbol
+}
+
+func newExpGrammar() expGrammar {
+	g := expGrammar{
+		S:     NewSymbol("S"),
+		exp:   NewSymbol("exp"),
+		plus:  NewSymbol("add"),
+		minus: NewSymbol("minus"),
+		mult:  NewSymbol("mult"),
+		cnst:  NewSymbol("const"),
+		param: NewSymbol("param"),
+		let:   NewSymbol("let"),
+		v:     NewSymbol("var"),
+	}
+	g.gram = NewGrammar(g.S)
+	g.gram.AddRule(g.S, g.exp)
+	g.gram.AddRule(g.exp, g.plus)
+	g.gram.AddRule(g.exp, g.minus)
+	g.gram.AddRule(g.exp, g.mult)
+	g.gram.AddRule(g.exp, g.cnst)
+	g.gram.AddRule(g.exp, g.param)
+	g.gram.AddRule(g.exp, g.let)
+	g.gram.AddRule(g.exp, g.v)
+	g.gram.AddRule(g.plus, g.exp, g.exp)
+	g.gram.AddRule(g.minus, g.exp, g.exp)
+	g.gram.AddRule(g.mult, g.exp, g.exp)
+	g.gram.AddRule(g.let, g.exp, g.exp)
+	return g
+}
+
+// S[exp[add[exp[const(1)],exp[param(0)]]]]
+func (g expGrammar) onePlusParam() *PGM {
+	return &PGM{
+		Symbol: g.S, Children: []*PGM{
+			&PGM{
+				Symbol: g.exp, Children: []*PGM{
+					&PGM{
+						Symbol: g.plus, Children: []*PGM{
+							&PGM{Symbol: g.exp, Children: []*PGM{&PGM{Symbol: g.cnst, value: 1}}},
+							&PGM{Symbol: g.exp, Children: []*PGM{&PGM{Symbol: g.param, value: 0}}},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+type point struct {
+	X, Y int
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	g := newExpGrammar()
+	values := NewValueRegistry()
+	values.Register("point", point{})
+	codec := NewCodec(&g.gram, values)
+
+	tests := []struct {
+		name string
+		pgm  *PGM
+	}{
+		{
+			name: "1+param(0)",
+			pgm:  g.onePlusParam(),
+		},
+		{
+			name: "hole",
+			pgm:  &PGM{Symbol: g.S, Children: []*PGM{&PGM{Symbol: g.exp}}},
+		},
+		{
+			name: "values of every builtin type",
+			pgm: &PGM{
+				Symbol: g.mult, Children: []*PGM{
+					&PGM{Symbol: g.exp, Children: []*PGM{&PGM{Symbol: g.cnst, value: -7}}},
+					&PGM{Symbol: g.exp, Children: []*PGM{&PGM{Symbol: g.cnst, value: "str"}}},
+				},
+			},
+		},
+		{
+			name: "custom value",
+			pgm:  &PGM{Symbol: g.cnst, value: point{X: 1, Y: -2}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"/json", func(t *testing.T) {
+			data, err := codec.EncodeJSON(tt.pgm)
+			if err != nil {
+				t.Fatalf("Codec.EncodeJSON() error = %v", err)
+			}
+			got, err := codec.DecodeJSON(data)
+			if err != nil {
+				t.Fatalf("Codec.DecodeJSON() error = %v", err)
+			}
+			if got.String() != tt.pgm.String() {
+				t.Errorf("Codec.DecodeJSON() = %v, want %v", got, tt.pgm)
+			}
+		})
+		t.Run(tt.name+"/binary", func(t *testing.T) {
+			data, err := codec.EncodeBinary(tt.pgm)
+			if err != nil {
+				t.Fatalf("Codec.EncodeBinary() error = %v", err)
+			}
+			got, err := codec.DecodeBinary(data)
+			if err != nil {
+				t.Fatalf("Codec.DecodeBinary() error = %v", err)
+			}
+			if got.String() != tt.pgm.String() {
+				t.Errorf("Codec.DecodeBinary() = %v, want %v", got, tt.pgm)
+			}
+		})
+	}
+}
+
+func TestCodec_Stream(t *testing.T) {
+	g := newExpGrammar()
+	codec := NewCodec(&g.gram, nil)
+
+	pgms := []*PGM{
+		g.onePlusParam(),
+		&PGM{Symbol: g.cnst, value: 3},
+		g.onePlusParam(),
+	}
+	var buf bytes.Buffer
+	enc := codec.NewEncoder(&buf)
+	for _, pgm := range pgms {
+		if err := enc.Encode(pgm); err != nil {
+			t.Fatalf("TreeEncoder.Encode() error = %v", err)
+		}
+	}
+
+	dec := codec.NewDecoder(&buf)
+	for _, want := range pgms {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("TreeDecoder.Decode() error = %v", err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("TreeDecoder.Decode() = %v, want %v", got, want)
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("TreeDecoder.Decode() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestCodec_Invalid(t *testing.T) {
+	g := newExpGrammar()
+	codec := NewCodec(&g.gram, nil)
+	other := NewSymbol("other")
+
+	tests := []struct {
+		name string
+		pgm  *PGM
+	}{
+		{
+			name: "unknown symbol",
+			pgm:  &PGM{Symbol: g.S, Children: []*PGM{&PGM{Symbol: other}}},
+		},
+		{
+			name: "no matching rule",
+			pgm:  &PGM{Symbol: g.plus, Children: []*PGM{&PGM{Symbol: g.exp}}},
+		},
+		{
+			name: "children of a terminal",
+			pgm:  &PGM{Symbol: g.cnst, Children: []*PGM{&PGM{Symbol: g.cnst}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"/json", func(t *testing.T) {
+			data, err := codec.EncodeJSON(tt.pgm)
+			if err != nil {
+				t.Fatalf("Codec.EncodeJSON() error = %v", err)
+			}
+			if got, err := codec.DecodeJSON(data); err == nil {
+				t.Errorf("Codec.DecodeJSON() = %v, want an error", got)
+			}
+		})
+		t.Run(tt.name+"/binary", func(t *testing.T) {
+			data, err := codec.EncodeBinary(tt.pgm)
+			if err != nil {
+				t.Fatalf("Codec.EncodeBinary() error = %v", err)
+			}
+			if got, err := codec.DecodeBinary(data); err == nil {
+				t.Errorf("Codec.DecodeBinary() = %v, want an error", got)
+			}
+		})
+	}
+
+	t.Run("truncated binary", func(t *testing.T) {
+		data, _ := codec.EncodeBinary(g.onePlusParam())
+		for i := 1; i < len(data); i++ {
+			if got, err := codec.DecodeBinary(data[:i]); err == nil {
+				t.Errorf("Codec.DecodeBinary() = %v, want an error", got)
+			}
+		}
+	})
+
+	t.Run("too deep", func(t *testing.T) {
+		deep := &PGM{Symbol: g.cnst, value: 1}
+		for i := 0; i < maxTreeDepth; i++ {
+			deep = &PGM{Symbol: g.exp, Children: []*PGM{deep}}
+		}
+		data, err := codec.EncodeBinary(deep)
+		if err != nil {
+			t.Fatalf("Codec.EncodeBinary() error = %v", err)
+		}
+		if _, err := codec.DecodeBinary(data); err == nil || !strings.Contains(err.Error(), "deeper") {
+			t.Errorf("Codec.DecodeBinary() error = %v, want too deep", err)
+		}
+		nested := strings.Repeat(`{"symbol":"exp","children":[`, maxTreeDepth) + `{"symbol":"const"}` +
+			strings.Repeat(`]}`, maxTreeDepth)
+		if _, err := codec.DecodeJSON([]byte(nested)); err == nil {
+			t.Errorf("Codec.DecodeJSON() want an error")
+		}
+	})
+
+	t.Run("error of a deep tree", func(t *testing.T) {
+		deep := &PGM{Symbol: g.cnst, value: 1}
+		for i := 0; i < maxTreeDepth; i++ {
+			deep = &PGM{Symbol: g.exp, Children: []*PGM{deep}}
+		}
+		err := g.gram.Validate(&PGM{Symbol: g.plus, Children: []*PGM{deep}})
+		if want := "no rule of add matches the children [exp]"; err == nil || err.Error() != want {
+			t.Errorf("Grammar.Validate() error = %v, want %v", err, want)
+		}
+	})
+
+	t.Run("unregistered value type", func(t *testing.T) {
+		if _, err := codec.EncodeJSON(&PGM{Symbol: g.cnst, value: point{}}); err == nil {
+			t.Errorf("Codec.EncodeJSON() want an error")
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package dsl
+
+import (
+	"errors"
+	"fmt"
+)
+
+type ErrorKind int
+
+const (
+	// Failure is an error of the semantics of the DSL, like division by zero.
+	Failure ErrorKind = iota
+	ArgOutOfRange
+	MissingValue
+	TypeMismatch
+	OutOfFuel
+	DepthExceeded
+	Canceled
+	Unbound
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case Failure:
+		return "failure"
+	case ArgOutOfRange:
+		return "argument out of range"
+	case MissingValue:
+		return "missing value"
+	case TypeMismatch:
+		return "type mismatch"
+	case OutOfFuel:
+		return "out of fuel"
+	case DepthExceeded:
+		return "depth exceeded"
+	case Canceled:
+		return "canceled"
+	case Unbound:
+		return "unbound variable"
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// EvalError is an error in the evaluation of a program. Node is the node
+// being evaluated, if known, and Evaluator.Eval fills Path with its path
+// from the evaluated root.
+type EvalError struct {
+	Kind    ErrorKind
+	Node    *ProgramTree
+	Path    Path
+	Message string
+	// Cause is the error of the semantics the EvalError wraps, if any.
+	Cause error
+}
+
+func NewEvalError(kind ErrorKind, node *ProgramTree, format string, args ...interface{}) *EvalError {
+	return &EvalError{
+		Kind:    kind,
+		Node:    node,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *EvalError) Error() string {
+	if e.Path == nil {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("%s at %s: %s", e.Kind, e.Path, e.Message)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Cause
+}
+
+// locate returns the error with the path of its node in root. A node shared
+// by several paths is located at the first one in pre-order.
+func (e *EvalError) locate(root *ProgramTree) *EvalError {
+	if e.Node == nil || e.Path != nil {
+		return e
+	}
+	for p, n := range root.PreOrder() {
+		if n == e.Node {
+			located := *e
+			located.Path = p.Clone()
+			return &located
+		}
+	}
+	return e
+}
+
+// IsKind reports whether err is an EvalError of the kind.
+func IsKind(err error, kind ErrorKind) bool {
+	var evalErr *EvalError
+	return errors.As(err, &evalErr) && evalErr.Kind == kind
+}
@@ -0,0 +1,87 @@
+package dsl
+
+import "fmt"
+
+// Forest hash-conses program trees: structurally equal trees built by the
+// same forest are the same pointer, and trees share all common subtrees.
+// Trees of a forest are immutable; modifying them with AddChildren, With
+// or through Children corrupts every tree sharing the node.
+type Forest struct {
+	nodes map[uint64][]*ProgramTree
+	size  int
+}
+
+func NewForest() *Forest {
+	return &Forest{
+		nodes: make(map[uint64][]*ProgramTree),
+	}
+}
+
+// Node returns the canonical node of the symbol, value and children, which
+// must be nodes of this forest. A nil value makes a node without value.
+func (f *Forest) Node(s *Symbol, value interface{}, children ...*ProgramTree) *ProgramTree {
+	node := &ProgramTree{
+		Symbol:   s,
+		Children: make([]*ProgramTree, len(children)),
+		value:    value,
+	}
+	copy(node.Children, children)
+
+	h := node.Hash()
+	for _, c := range f.nodes[h] {
+		if c.Symbol == node.Symbol && sameChildren(c.Children, node.Children) && EqualValue(c.value, node.value) {
+			return c
+		}
+	}
+	node.frozen = true
+	node.hash, node.hashed = h, true
+	f.nodes[h] = append(f.nodes[h], node)
+	f.size++
+	return node
+}
+
+func sameChildren(a, b []*ProgramTree) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Intern returns the canonical copy of any tree in this forest.
+func (f *Forest) Intern(t *ProgramTree) *ProgramTree {
+	children := make([]*ProgramTree, len(t.Children))
+	for i, c := range t.Children {
+		children[i] = f.Intern(c)
+	}
+	return f.Node(t.Symbol, t.value, children...)
+}
+
+// Replace returns a new root where the node at the path is replaced with
+// sub, sharing every subtree off the path with root. Both root and sub must
+// be nodes of this forest. Replace panics if the path is out of range.
+func (f *Forest) Replace(root *ProgramTree, p Path, sub *ProgramTree) *ProgramTree {
+	if len(p) == 0 {
+		return sub
+	}
+	i := p[0]
+	if i < 0 || i >= len(root.Children) {
+		panic(fmt.Sprintf("dsl: path index %d out of range of %s", i, root))
+	}
+	child := f.Replace(root.Children[i], p[1:], sub)
+	if child == root.Children[i] {
+		return root
+	}
+	children := make([]*ProgramTree, len(root.Children))
+	copy(children, root.Children)
+	children[i] = child
+	return f.Node(root.Symbol, root.value, children...)
+}
+
+func (f *Forest) Len() int {
+	return f.size
+}
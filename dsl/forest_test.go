@@ -0,0 +1,95 @@
+package dsl
+
+import "testing"
+
+func TestForest_Node(t *testing.T) {
+	plus := NewSymbol("add")
+	cnst := NewSymbol("const")
+
+	f := NewForest()
+	c1 := f.Node(cnst, 1)
+	if got := f.Node(cnst, 1); got != c1 {
+		t.Errorf("Forest.Node() = %p, want the shared node %p", got, c1)
+	}
+	if got := f.Node(cnst, 2); got == c1 {
+		t.Errorf("Forest.Node() shares nodes of different values")
+	}
+	if got := f.Node(cnst, nil); got == c1 {
+		t.Errorf("Forest.Node() shares nodes with and without value")
+	}
+
+	children := []*PGM{c1, f.Node(cnst, 2)}
+	p1 := f.Node(plus, nil, children...)
+	children[0] = f.Node(cnst, 3)
+	if got := f.Node(plus, nil, c1, f.Node(cnst, 2)); got != p1 {
+		t.Errorf("Forest.Node() = %v, want the shared node %v", got, p1)
+	}
+	if got, want := f.Len(), 5; got != want {
+		t.Errorf("Forest.Len() = %d, want %d", got, want)
+	}
+}
+
+func TestForest_Intern(t *testing.T) {
+	plus := NewSymbol("add")
+	cnst := NewSymbol("const")
+
+	f := NewForest()
+	org := &PGM{Symbol: plus, Children: []*PGM{
+		&PGM{Symbol: cnst, value: 1}, &PGM{Symbol: cnst, value: 1},
+	}}
+	got := f.Intern(org)
+	if !Equal(got, org) {
+		t.Errorf("Forest.Intern() = %v, want %v", got, org)
+	}
+	if got.Children[0] != got.Children[1] {
+		t.Errorf("Forest.Intern() does not share equal subtrees")
+	}
+	if again := f.Intern(org.Clone()); again != got {
+		t.Errorf("Forest.Intern() = %p, want %p", again, got)
+	}
+}
+
+func TestForest_Replace(t *testing.T) {
+	plus := NewSymbol("add")
+	mult := NewSymbol("mult")
+	cnst := NewSymbol("const")
+
+	f := NewForest()
+	// (1+4)*3
+	root := f.Intern(&PGM{
+		Symbol: mult, Children: []*PGM{
+			&PGM{
+				Symbol: plus, Children: []*PGM{
+					&PGM{Symbol: cnst, value: 1},
+					&PGM{Symbol: cnst, value: 4},
+				},
+			},
+			&PGM{Symbol: cnst, value: 3},
+		},
+	})
+	before := root.String()
+
+	got := f.Replace(root, Path{0, 1}, f.Node(cnst, 5))
+	if want := `"mult"["add"["const"(1),"const"(5)],"const"(3)]`; got.String() != want {
+		t.Errorf("Forest.Replace() = %v, want %v", got, want)
+	}
+	if root.String() != before {
+		t.Errorf("Forest.Replace() modified the original tree to %v", root)
+	}
+	if got.Children[1] != root.Children[1] || got.Children[0].Children[0] != root.Children[0].Children[0] {
+		t.Errorf("Forest.Replace() does not share the untouched subtrees")
+	}
+	if same := f.Replace(root, Path{1}, f.Node(cnst, 3)); same != root {
+		t.Errorf("Forest.Replace() = %p, want the original root %p", same, root)
+	}
+	if sub := f.Node(cnst, 0); f.Replace(root, Path{}, sub) != sub {
+		t.Errorf("Forest.Replace() with the empty path does not return the replacement")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Forest.Replace() does not panic with an invalid path")
+		}
+	}()
+	f.Replace(root, Path{2}, f.Node(cnst, 0))
+}
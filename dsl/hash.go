@@ -0,0 +1,233 @@
+package dsl
+
+import (
+	"math"
+	"reflect"
+)
+
+const (
+	fnvOffset = 14695981039346656037
+	fnvPrime  = 1099511628211
+)
+
+func hashBytes(h uint64, b []byte) uint64 {
+	for _, c := range b {
+		h ^= uint64(c)
+		h *= fnvPrime
+	}
+	return h
+}
+
+func hashString(h uint64, s string) uint64 {
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= fnvPrime
+	}
+	return h
+}
+
+func hashUint64(h uint64, v uint64) uint64 {
+	for i := 0; i < 8; i++ {
+		h ^= v & 0xff
+		h *= fnvPrime
+		v >>= 8
+	}
+	return h
+}
+
+func hashValue(h uint64, value interface{}) uint64 {
+	switch v := value.(type) {
+	case int:
+		return hashUint64(hashString(h, "int"), uint64(v))
+	case int64:
+		return hashUint64(hashString(h, "int64"), uint64(v))
+	case float64:
+		return hashUint64(hashString(h, "float64"), floatBits(v))
+	case bool:
+		if v {
+			return hashString(h, "true")
+		}
+		return hashString(h, "false")
+	case string:
+		return hashString(hashUint64(hashString(h, "string"), uint64(len(v))), v)
+	default:
+		return hashReflect(h, reflect.ValueOf(v), 0)
+	}
+}
+
+// HashValue returns a hash of the value, which is the same for the values
+// equal by EqualValue and tells apart the types, like 1 and 1.0.
+func HashValue(value interface{}) uint64 {
+	return hashValue(fnvOffset, value)
+}
+
+// floatBits returns the bits of the float, where -0 has the bits of 0 since
+// they are equal.
+func floatBits(v float64) uint64 {
+	if v == 0 {
+		return 0
+	}
+	return math.Float64bits(v)
+}
+
+// maxHashDepth bounds the nesting of the values hashed, beyond which only
+// the types are, so that cyclic values are hashed too.
+const maxHashDepth = 32
+
+// hashReflect hashes the value so that the values equal by EqualValue have
+// the same hash. Pointers, functions and channels are hashed by their types
+// only, so that the hash doesn't depend on addresses.
+func hashReflect(h uint64, v reflect.Value, depth int) uint64 {
+	if !v.IsValid() {
+		return hashString(h, "nil")
+	}
+	h = hashString(h, v.Type().String())
+	if depth > maxHashDepth {
+		return h
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return hashBytes(h, []byte{1})
+		}
+		return hashBytes(h, []byte{0})
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return hashUint64(h, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return hashUint64(h, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return hashUint64(h, floatBits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return hashUint64(hashUint64(h, floatBits(real(c))), floatBits(imag(c)))
+	case reflect.String:
+		return hashString(hashUint64(h, uint64(v.Len())), v.String())
+	case reflect.Slice, reflect.Array:
+		// a nil slice isn't equal to an empty one
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return hashBytes(h, []byte{0})
+		}
+		h = hashUint64(hashBytes(h, []byte{1}), uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			h = hashReflect(h, v.Index(i), depth+1)
+		}
+		return h
+	case reflect.Map:
+		if v.IsNil() {
+			return hashBytes(h, []byte{0})
+		}
+		// the entries are summed since their order is random
+		var sum uint64
+		iter := v.MapRange()
+		for iter.Next() {
+			entry := hashReflect(uint64(fnvOffset), iter.Key(), depth+1)
+			sum += hashReflect(entry, iter.Value(), depth+1)
+		}
+		return hashUint64(hashUint64(hashBytes(h, []byte{1}), uint64(v.Len())), sum)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			h = hashReflect(h, v.Field(i), depth+1)
+		}
+		return h
+	case reflect.Interface:
+		return hashReflect(h, v.Elem(), depth+1)
+	}
+	return h
+}
+
+// Hash returns a structural hash of the symbols and values of the tree,
+// which is stable across processes since values are hashed by their
+// contents and not by their addresses. The hash is cached only in the nodes
+// of a Forest, since any other tree may be modified through Children.
+func (n *ProgramTree) Hash() uint64 {
+	if n.hashed {
+		return n.hash
+	}
+	h := hashString(uint64(fnvOffset), n.Symbol.Id)
+	if val, ok := n.Value(); ok {
+		h = hashValue(hashBytes(h, []byte{1}), val)
+	} else {
+		h = hashBytes(h, []byte{0})
+	}
+	h = hashUint64(h, uint64(len(n.Children)))
+	for _, c := range n.Children {
+		h = hashUint64(h, c.Hash())
+	}
+	if n.frozen {
+		n.hash, n.hashed = h, true
+	}
+	return h
+}
+
+// Equal compares the trees node by node.
+func Equal(a, b *ProgramTree) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil {
+		return false
+	}
+	if a.Symbol != b.Symbol || len(a.Children) != len(b.Children) {
+		return false
+	}
+	if !EqualValue(a.value, b.value) {
+		return false
+	}
+	for i := range a.Children {
+		if !Equal(a.Children[i], b.Children[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// EqualValue reports whether the values are deeply equal, like
+// reflect.DeepEqual.
+func EqualValue(a, b interface{}) bool {
+	switch v := a.(type) {
+	case int:
+		w, ok := b.(int)
+		return ok && v == w
+	case string:
+		w, ok := b.(string)
+		return ok && v == w
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+type TreeSet struct {
+	buckets map[uint64][]*ProgramTree
+	size    int
+}
+
+func NewTreeSet() *TreeSet {
+	return &TreeSet{
+		buckets: make(map[uint64][]*ProgramTree),
+	}
+}
+
+// Add inserts the tree and reports whether it was not in the set yet.
+func (s *TreeSet) Add(t *ProgramTree) bool {
+	h := t.Hash()
+	for _, u := range s.buckets[h] {
+		if Equal(t, u) {
+			return false
+		}
+	}
+	s.buckets[h] = append(s.buckets[h], t)
+	s.size++
+	return true
+}
+
+func (s *TreeSet) Contains(t *ProgramTree) bool {
+	for _, u := range s.buckets[t.Hash()] {
+		if Equal(t, u) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *TreeSet) Len() int {
+	return s.size
+}
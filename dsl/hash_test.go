@@ -0,0 +1,209 @@
+package dsl
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEqual(t *testing.T) {
+	plus := NewSymbol("add")
+	mult := NewSymbol("mult")
+	cnst := NewSymbol("const")
+	other := NewSymbol("const")
+
+	tests := []struct {
+		name string
+		a, b *PGM
+		want bool
+	}{
+		{
+			name: "same structure",
+			a: &PGM{Symbol: plus, Children: []*PGM{
+				&PGM{Symbol: cnst, value: 1}, &PGM{Symbol: cnst, value: 4},
+			}},
+			b: &PGM{Symbol: plus, Children: []*PGM{
+				&PGM{Symbol: cnst, value: 1}, &PGM{Symbol: cnst, value: 4},
+			}},
+			want: true,
+		},
+		{
+			name: "different symbol",
+			a:    &PGM{Symbol: plus},
+			b:    &PGM{Symbol: mult},
+			want: false,
+		},
+		{
+			name: "different symbol with the same id",
+			a:    &PGM{Symbol: cnst},
+			b:    &PGM{Symbol: other},
+			want: false,
+		},
+		{
+			name: "different value",
+			a:    &PGM{Symbol: cnst, value: 1},
+			b:    &PGM{Symbol: cnst, value: 2},
+			want: false,
+		},
+		{
+			name: "different value type",
+			a:    &PGM{Symbol: cnst, value: 1},
+			b:    &PGM{Symbol: cnst, value: int64(1)},
+			want: false,
+		},
+		{
+			name: "missing value",
+			a:    &PGM{Symbol: cnst, value: 1},
+			b:    &PGM{Symbol: cnst},
+			want: false,
+		},
+		{
+			name: "different children",
+			a: &PGM{Symbol: plus, Children: []*PGM{
+				&PGM{Symbol: cnst, value: 1}, &PGM{Symbol: cnst, value: 4},
+			}},
+			b: &PGM{Symbol: plus, Children: []*PGM{
+				&PGM{Symbol: cnst, value: 4}, &PGM{Symbol: cnst, value: 1},
+			}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Equal(tt.a, tt.b); got != tt.want {
+				t.Errorf("Equal() = %v, want %v", got, tt.want)
+			}
+			if tt.want && tt.a.Hash() != tt.b.Hash() {
+				t.Errorf("ProgramTree.Hash() differs for equal trees %v and %v", tt.a, tt.b)
+			}
+			if tt.a.Symbol.Id == tt.b.Symbol.Id || tt.want {
+				return
+			}
+			if tt.a.Hash() == tt.b.Hash() {
+				t.Errorf("ProgramTree.Hash() collides for %v and %v", tt.a, tt.b)
+			}
+		})
+	}
+}
+
+func TestProgramTree_Hash_Cache(t *testing.T) {
+	exp := NewSymbol("exp")
+	exp.isTerminal = false
+	plus := NewSymbol("add")
+	cnst := NewSymbol("const")
+
+	leaf := NewProgramTree(cnst).With(1)
+	child := NewProgramTree(plus)
+	child.AddChildren(leaf)
+	tree := NewProgramTree(plus)
+	tree.AddChildren(child)
+	before := tree.Hash()
+
+	tests := []struct {
+		name string
+		edit func()
+	}{
+		{name: "With on a descendant", edit: func() { leaf.With(2) }},
+		{name: "AddChildren on a descendant", edit: func() { child.AddChildren(NewProgramTree(exp)) }},
+		{name: "through Children", edit: func() { child.Children[0] = NewProgramTree(exp) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.edit()
+			if tree.Hash() == before {
+				t.Errorf("ProgramTree.Hash() is not updated after the edit")
+			}
+			if got, want := tree.Hash(), tree.Clone().Hash(); got != want {
+				t.Errorf("ProgramTree.Hash() = %v, want %v", got, want)
+			}
+			before = tree.Hash()
+		})
+	}
+	f := NewForest()
+	if got, want := f.Intern(tree).Hash(), tree.Hash(); got != want {
+		t.Errorf("Forest.Intern().Hash() = %v, want %v", got, want)
+	}
+}
+
+func TestEqual_ModifiedChild(t *testing.T) {
+	plus := NewSymbol("add")
+	cnst := NewSymbol("const")
+	leaf := NewProgramTree(cnst).With(1)
+	a := NewProgramTree(plus)
+	a.AddChildren(leaf)
+	b := NewProgramTree(plus)
+	b.AddChildren(NewProgramTree(cnst).With(2))
+	a.Hash()
+	b.Hash()
+
+	leaf.With(2)
+	if !Equal(a, b) {
+		t.Errorf("Equal() = false for equal trees after modifying a child")
+	}
+	if a.Hash() != b.Hash() {
+		t.Errorf("ProgramTree.Hash() differs for equal trees after modifying a child")
+	}
+}
+
+func TestHashValue(t *testing.T) {
+	type row struct {
+		Name  string
+		Score float64
+	}
+	x, y := 1, 1
+	tests := []struct {
+		name string
+		a, b interface{}
+	}{
+		{name: "zeros", a: 0.0, b: math.Copysign(0, -1)},
+		{name: "float32 zeros", a: float32(0), b: float32(math.Copysign(0, -1))},
+		{name: "zeros in slices", a: []float64{0}, b: []float64{math.Copysign(0, -1)}},
+		{name: "structs", a: row{"a", 0}, b: row{"a", math.Copysign(0, -1)}},
+		{name: "maps", a: map[string]int{"a": 1, "b": 2, "c": 3}, b: map[string]int{"c": 3, "b": 2, "a": 1}},
+		{name: "pointers", a: &x, b: &y},
+		{name: "nested", a: []interface{}{[]int{1}, "a"}, b: []interface{}{[]int{1}, "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !EqualValue(tt.a, tt.b) {
+				t.Fatalf("EqualValue(%v, %v) = false", tt.a, tt.b)
+			}
+			if hashValue(fnvOffset, tt.a) != hashValue(fnvOffset, tt.b) {
+				t.Errorf("hashValue() differs for the equal values %v and %v", tt.a, tt.b)
+			}
+		})
+	}
+
+	if hashValue(fnvOffset, []int(nil)) == hashValue(fnvOffset, []int{}) {
+		t.Errorf("hashValue() is the same for nil and empty slices")
+	}
+	if hashValue(fnvOffset, []int{1, 2}) == hashValue(fnvOffset, []int{2, 1}) {
+		t.Errorf("hashValue() is the same for different slices")
+	}
+}
+
+func TestTreeSet(t *testing.T) {
+	plus := NewSymbol("add")
+	cnst := NewSymbol("const")
+	newTree := func(a, b int) *PGM {
+		return &PGM{Symbol: plus, Children: []*PGM{
+			&PGM{Symbol: cnst, value: a}, &PGM{Symbol: cnst, value: b},
+		}}
+	}
+
+	set := NewTreeSet()
+	if !set.Add(newTree(1, 2)) {
+		t.Errorf("TreeSet.Add() = false for a new tree")
+	}
+	if set.Add(newTree(1, 2)) {
+		t.Errorf("TreeSet.Add() = true for a duplicate tree")
+	}
+	if !set.Add(newTree(2, 1)) {
+		t.Errorf("TreeSet.Add() = false for a new tree")
+	}
+	if !set.Contains(newTree(2, 1)) || set.Contains(newTree(2, 2)) {
+		t.Errorf("TreeSet.Contains() is incorrect")
+	}
+	if got := set.Len(); got != 2 {
+		t.Errorf("TreeSet.Len() = %d, want %d", got, 2)
+	}
+}
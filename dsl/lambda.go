@@ -0,0 +1,156 @@
+package dsl
+
+import "fmt"
+
+// Closure is the function value of a lambda node with the Env it is
+// evaluated in. A function of several parameters is curried.
+type Closure struct {
+	Node  *ProgramTree
+	param string
+	env   Env
+	body  func(env Env) EvalResult
+}
+
+func (c *Closure) String() string {
+	return fmt.Sprintf("<closure %s of %s>", c.param, c.Node)
+}
+
+// Call applies the closure to the arguments one by one.
+func (c *Closure) Call(args ...Value) (Value, error) {
+	if len(args) == 0 {
+		return c, nil
+	}
+	r := c.body(c.env.Extend(c.param, args[0]))
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(args) == 1 {
+		return r.value, nil
+	}
+	next, ok := r.value.(*Closure)
+	if !ok {
+		return nil, NewEvalError(TypeMismatch, c.Node, "%v is not a function to apply to %d more arguments", r.value, len(args)-1)
+	}
+	return next.Call(args[1:]...)
+}
+
+// Lambda is the FormFunc of the nodes whose value is the name of the
+// parameter and whose only child is the body, evaluated to a Closure.
+func Lambda(node *ProgramTree, env Env, eval func(i int, env Env) EvalResult) EvalResult {
+	param, ok := ValueOf[string](node)
+	if !ok {
+		return NewEvalErrorResult(NewEvalError(MissingValue, node, "%s doesn't have the parameter", node.Symbol))
+	}
+	if len(node.Children) != 1 {
+		return NewEvalErrorResult(NewEvalError(Failure, node, "%s has %d children, not 1", node.Symbol, len(node.Children)))
+	}
+	return NewEvalResult(&Closure{
+		Node:  node,
+		param: param,
+		env:   env,
+		body: func(env Env) EvalResult {
+			return eval(0, env)
+		},
+	})
+}
+
+func asClosure(v Value) (*Closure, error) {
+	c, ok := v.(*Closure)
+	if !ok {
+		return nil, NewEvalError(TypeMismatch, nil, "%v is not a function", v)
+	}
+	return c, nil
+}
+
+func asList(v Value) ([]Value, error) {
+	l, ok := v.([]Value)
+	if !ok {
+		return nil, NewEvalError(TypeMismatch, nil, "%v is %T, not a list", v, v)
+	}
+	return l, nil
+}
+
+// Apply applies the first argument to the others.
+func Apply(args ...Value) (Value, error) {
+	if len(args) == 0 {
+		return nil, NewEvalError(Failure, nil, "no function to apply")
+	}
+	f, err := asClosure(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return f.Call(args[1:]...)
+}
+
+// ListMap, ListFilter and ListFold are the higher-order functions over lists, which are
+// []Value, taking the function first like map(f, xs) and fold(f, init, xs).
+func ListMap(args ...Value) (Value, error) {
+	if len(args) != 2 {
+		return nil, NewEvalError(Failure, nil, "map takes 2 arguments, not %d", len(args))
+	}
+	f, err := asClosure(args[0])
+	if err != nil {
+		return nil, err
+	}
+	xs, err := asList(args[1])
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]Value, len(xs))
+	for i, x := range xs {
+		if ret[i], err = f.Call(x); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func ListFilter(args ...Value) (Value, error) {
+	if len(args) != 2 {
+		return nil, NewEvalError(Failure, nil, "filter takes 2 arguments, not %d", len(args))
+	}
+	f, err := asClosure(args[0])
+	if err != nil {
+		return nil, err
+	}
+	xs, err := asList(args[1])
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]Value, 0)
+	for _, x := range xs {
+		v, err := f.Call(x)
+		if err != nil {
+			return nil, err
+		}
+		keep, ok := v.(bool)
+		if !ok {
+			return nil, NewEvalError(TypeMismatch, nil, "%v is %T, not bool", v, v)
+		}
+		if keep {
+			ret = append(ret, x)
+		}
+	}
+	return ret, nil
+}
+
+func ListFold(args ...Value) (Value, error) {
+	if len(args) != 3 {
+		return nil, NewEvalError(Failure, nil, "fold takes 3 arguments, not %d", len(args))
+	}
+	f, err := asClosure(args[0])
+	if err != nil {
+		return nil, err
+	}
+	xs, err := asList(args[2])
+	if err != nil {
+		return nil, err
+	}
+	acc := args[1]
+	for _, x := range xs {
+		if acc, err = f.Call(acc, x); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
@@ -0,0 +1,144 @@
+package dsl
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestLambda(t *testing.T) {
+	S := NewSymbol("S")
+	exp := NewSymbol("exp")
+	lambda := NewSymbol("lambda")
+	apply := NewSymbol("apply")
+	mapf := NewSymbol("map")
+	filter := NewSymbol("filter")
+	fold := NewSymbol("fold")
+	plus := NewSymbol("add")
+	gt := NewSymbol("gt")
+	v := NewSymbol("var")
+	c := NewSymbol("const")
+	input := NewSymbol("input")
+
+	gram := NewGrammar(S)
+	gram.AddRule(S, exp)
+	for _, s := range []*Symbol{lambda, apply, mapf, filter, fold, plus, gt, v, c, input} {
+		gram.AddRule(exp, s)
+	}
+	gram.AddRule(lambda, exp)
+	gram.AddRule(apply, exp, exp)
+	gram.AddRule(apply, exp, exp, exp)
+	gram.AddRule(mapf, exp, exp)
+	gram.AddRule(filter, exp, exp)
+	gram.AddRule(fold, exp, exp, exp)
+	gram.AddRule(plus, exp, exp)
+	gram.AddRule(gt, exp, exp)
+
+	evaluator := NewSemantics(&gram).
+		RegisterForm(lambda, Lambda).
+		Register(apply, Apply).
+		Register(mapf, ListMap).
+		Register(filter, ListFilter).
+		Register(fold, ListFold).
+		Register(plus, Binary(func(a, b int) int { return a + b })).
+		Register(gt, Binary(func(a, b int) bool { return a > b })).
+		RegisterLeaf(v, Variable).
+		RegisterLeaf(c, Constant).
+		RegisterLeaf(input, Argument).
+		MarkPure().
+		Evaluator()
+
+	fn := func(param string, body *PGM) *PGM {
+		return &PGM{Symbol: lambda, value: param, Children: []*PGM{body}}
+	}
+	call := func(s *Symbol, args ...*PGM) *PGM {
+		return &PGM{Symbol: s, Children: args}
+	}
+	x := &PGM{Symbol: v, value: "x"}
+	acc := &PGM{Symbol: v, value: "acc"}
+	k := &PGM{Symbol: v, value: "k"}
+	xs := &PGM{Symbol: input, value: 0}
+	cnst := func(value int) *PGM { return &PGM{Symbol: c, value: value} }
+
+	tests := []struct {
+		name     string
+		pgm      *PGM
+		want     Value
+		wantKind ErrorKind
+		wantErr  bool
+	}{
+		{
+			name: "map(λx. x + 1, xs)",
+			pgm:  call(mapf, fn("x", call(plus, x, cnst(1))), xs),
+			want: []Value{2, 3, 4},
+		},
+		{
+			name: "filter(λx. x > 1, xs)",
+			pgm:  call(filter, fn("x", call(gt, x, cnst(1))), xs),
+			want: []Value{2, 3},
+		},
+		{
+			name: "fold(λacc. λx. acc + x, 0, xs)",
+			pgm:  call(fold, fn("acc", fn("x", call(plus, acc, x))), cnst(0), xs),
+			want: 6,
+		},
+		{
+			name: "closure over k: apply(λk. map(λx. x + k, xs), 10)",
+			pgm: call(apply,
+				fn("k", call(mapf, fn("x", call(plus, x, k)), xs)), cnst(10)),
+			want: []Value{11, 12, 13},
+		},
+		{
+			name: "curried: apply(λacc. λx. acc + x, 1, 2)",
+			pgm:  call(apply, fn("acc", fn("x", call(plus, acc, x))), cnst(1), cnst(2)),
+			want: 3,
+		},
+		{
+			name:     "apply a non-function",
+			pgm:      call(apply, cnst(1), cnst(2)),
+			wantKind: TypeMismatch,
+			wantErr:  true,
+		},
+		{
+			name:     "filter with a non-predicate",
+			pgm:      call(filter, fn("x", x), xs),
+			wantKind: TypeMismatch,
+			wantErr:  true,
+		},
+		{
+			name:     "unbound in the body",
+			pgm:      call(mapf, fn("x", k), xs),
+			wantKind: Unbound,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewEvalCache(100)
+			env := NewEnv([]Value{1, 2, 3}).WithCache(cache)
+			results := map[string]EvalResult{
+				"Evaluator.Eval()": evaluator.Eval(tt.pgm, env),
+				"Program.Run()":    evaluator.Compile(tt.pgm).Run(env),
+			}
+			for name, got := range results {
+				if tt.wantErr {
+					if !IsKind(got.Err(), tt.wantKind) {
+						t.Errorf("%s error = %v, want an error of %v", name, got.Err(), tt.wantKind)
+					}
+					continue
+				}
+				if val, _ := got.Value(); !reflect.DeepEqual(val, tt.want) {
+					t.Errorf("%s = %v, want %v", name, val, tt.want)
+				}
+			}
+		})
+	}
+
+	t.Run("fuel of the calls", func(t *testing.T) {
+		pgm := call(mapf, fn("x", call(plus, x, cnst(1))), xs)
+		got := evaluator.EvalContext(context.Background(), pgm, NewEnv([]Value{1, 2, 3}), Limits{MaxSteps: 8})
+		if !IsKind(got.Err(), OutOfFuel) {
+			t.Errorf("Evaluator.EvalContext() error = %v, want an error of %v", got.Err(), OutOfFuel)
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package dsl
+
+import "context"
+
+// Limits bounds an evaluation, where zero means unbounded. MaxSteps is the
+// number of nodes evaluated and MaxDepth the depth of nested evaluations.
+type Limits struct {
+	MaxSteps int
+	MaxDepth int
+}
+
+// checkInterval is the number of steps between the checks of the context.
+const checkInterval = 64
+
+type budget struct {
+	ctx    context.Context
+	limits Limits
+	steps  int
+	depth  int
+}
+
+// EvalContext evaluates the tree within the limits, failing with OutOfFuel,
+// DepthExceeded or Canceled when they are exceeded or the context is done.
+func (e *Evaluator) EvalContext(ctx context.Context, ast *ProgramTree, env Env, limits Limits) EvalResult {
+	env.budget = &budget{ctx: ctx, limits: limits}
+	if err := env.budget.check(ast); err != nil {
+		return NewEvalErrorResult(err)
+	}
+	return e.Eval(ast, env)
+}
+
+// RunContext is EvalContext for the compiled program.
+func (p *Program) RunContext(ctx context.Context, env Env, limits Limits) EvalResult {
+	env.budget = &budget{ctx: ctx, limits: limits}
+	if err := env.budget.check(p.root); err != nil {
+		return NewEvalErrorResult(err)
+	}
+	return p.Run(env)
+}
+
+// Enter consumes a step of the budget of the evaluation to evaluate the
+// node, and must be paired with Leave when it succeeds. Evaluators built by
+// Semantics call them for every node, and other evaluators should do so to
+// be bounded by EvalContext and traced.
+func (e Env) Enter(node *ProgramTree) error {
+	b := e.budget
+	if b == nil {
+		e.enterTrace(node)
+		return nil
+	}
+	b.steps++
+	if b.limits.MaxSteps > 0 && b.steps > b.limits.MaxSteps {
+		return NewEvalError(OutOfFuel, node, "more than %d steps", b.limits.MaxSteps)
+	}
+	if b.limits.MaxDepth > 0 && b.depth >= b.limits.MaxDepth {
+		return NewEvalError(DepthExceeded, node, "deeper than %d", b.limits.MaxDepth)
+	}
+	if b.steps%checkInterval == 0 {
+		if err := b.check(node); err != nil {
+			return err
+		}
+	}
+	b.depth++
+	e.enterTrace(node)
+	return nil
+}
+
+func (e Env) Leave(node *ProgramTree, result EvalResult) {
+	if e.budget != nil {
+		e.budget.depth--
+	}
+	e.leaveTrace(node, result)
+}
+
+func (b *budget) check(node *ProgramTree) *EvalError {
+	if err := b.ctx.Err(); err != nil {
+		evalErr := NewEvalError(Canceled, node, "%v", err)
+		evalErr.Cause = err
+		return evalErr
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package dsl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEvaluator_EvalContext(t *testing.T) {
+	g := newExpGrammar()
+	evaluator := g.evaluator()
+	// 83 nodes of depth 43
+	pgm := g.polynomial(10)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		limits    Limits
+		want      int
+		wantKind  ErrorKind
+		wantCause error
+		wantErr   bool
+	}{
+		{name: "unbounded", ctx: context.Background(), want: 2037},
+		{name: "enough fuel", ctx: context.Background(), limits: Limits{MaxSteps: 1000}, want: 2037},
+		{name: "out of fuel", ctx: context.Background(), limits: Limits{MaxSteps: 50}, wantKind: OutOfFuel, wantErr: true},
+		{name: "shallow enough", ctx: context.Background(), limits: Limits{MaxDepth: 100}, want: 2037},
+		{name: "too deep", ctx: context.Background(), limits: Limits{MaxDepth: 10}, wantKind: DepthExceeded, wantErr: true},
+		{name: "canceled", ctx: canceled, wantKind: Canceled, wantCause: context.Canceled, wantErr: true},
+		{name: "deadline", ctx: expired, wantKind: Canceled, wantCause: context.DeadlineExceeded, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := map[string]EvalResult{
+				"Evaluator.EvalContext()": evaluator.EvalContext(tt.ctx, pgm, NewEnv(2), tt.limits),
+				"Program.RunContext()":    evaluator.Compile(pgm).RunContext(tt.ctx, NewEnv(2), tt.limits),
+			}
+			for name, got := range results {
+				if err := got.Err(); (err != nil) != tt.wantErr {
+					t.Fatalf("%s error = %v, wantErr %v", name, err, tt.wantErr)
+				}
+				if tt.wantErr {
+					if !IsKind(got.Err(), tt.wantKind) {
+						t.Errorf("%s error = %v, want an error of %v", name, got.Err(), tt.wantKind)
+					}
+					if tt.wantCause != nil && !errors.Is(got.Err(), tt.wantCause) {
+						t.Errorf("%s error = %v, want %v", name, got.Err(), tt.wantCause)
+					}
+					continue
+				}
+				if val, _ := got.Value(); val != tt.want {
+					t.Errorf("%s = %v, want %v", name, val, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package dsl
+
+type metrics struct {
+	size  int
+	depth int
+	holes int
+}
+
+// measure returns the metrics of the tree, cached in the nodes of a Forest
+// like Hash.
+func (n *ProgramTree) measure() metrics {
+	if n.measured {
+		return n.metrics
+	}
+	m := metrics{size: 1, depth: 1}
+	if len(n.Children) == 0 && !n.Symbol.IsTerminal() {
+		m.holes = 1
+	}
+	for _, c := range n.Children {
+		cm := c.measure()
+		m.size += cm.size
+		m.holes += cm.holes
+		if cm.depth+1 > m.depth {
+			m.depth = cm.depth + 1
+		}
+	}
+	if n.frozen {
+		n.metrics, n.measured = m, true
+	}
+	return m
+}
+
+// Size returns the number of nodes.
+func (n *ProgramTree) Size() int {
+	return n.measure().size
+}
+
+// Depth returns the number of nodes on the longest path from the root to a
+// leaf, which is 1 for a single node.
+func (n *ProgramTree) Depth() int {
+	return n.measure().depth
+}
+
+// Holes returns the number of non-terminal leaves.
+func (n *ProgramTree) Holes() int {
+	return n.measure().holes
+}
+
+func (n *ProgramTree) Histogram() map[*Symbol]int {
+	ret := make(map[*Symbol]int)
+	for _, node := range n.PreOrder() {
+		ret[node.Symbol]++
+	}
+	return ret
+}
+
+// CostFunc computes the cost of a node from the costs of its children.
+type CostFunc func(n *ProgramTree, childCosts []float64) float64
+
+func (n *ProgramTree) Cost(f CostFunc) float64 {
+	return Fold(n, f)
+}
+
+func SizeCost(n *ProgramTree, childCosts []float64) float64 {
+	cost := 1.0
+	for _, c := range childCosts {
+		cost += c
+	}
+	return cost
+}
+
+// WeightedCost sums the weights of all nodes, using def for the symbols
+// without weight.
+func WeightedCost(weights map[*Symbol]float64, def float64) CostFunc {
+	return func(n *ProgramTree, childCosts []float64) float64 {
+		cost, ok := weights[n.Symbol]
+		if !ok {
+			cost = def
+		}
+		for _, c := range childCosts {
+			cost += c
+		}
+		return cost
+	}
+}
@@ -0,0 +1,122 @@
+package dsl
+
+import "testing"
+
+func TestProgramTree_Metrics(t *testing.T) {
+	exp := NewSymbol("exp")
+	exp.isTerminal = false
+	plus := NewSymbol("add")
+	plus.isTerminal = false
+	mult := NewSymbol("mult")
+	mult.isTerminal = false
+	cnst := NewSymbol("const")
+
+	tests := []struct {
+		name      string
+		target    *PGM
+		wantSize  int
+		wantDepth int
+		wantHoles int
+		wantCost  float64
+	}{
+		{
+			name:      "leaf",
+			target:    &PGM{Symbol: cnst, value: 1},
+			wantSize:  1,
+			wantDepth: 1,
+			wantHoles: 0,
+			wantCost:  1,
+		},
+		{
+			name:      "(1+4)*3",
+			target:    newPathTestTree(plus, mult, cnst),
+			wantSize:  5,
+			wantDepth: 3,
+			wantHoles: 0,
+			wantCost:  7,
+		},
+		{
+			name: "(exp+exp)*exp",
+			target: &PGM{
+				Symbol: mult, Children: []*PGM{
+					&PGM{
+						Symbol: plus, Children: []*PGM{
+							&PGM{Symbol: exp},
+							&PGM{Symbol: exp},
+						},
+					},
+					&PGM{Symbol: exp},
+				},
+			},
+			wantSize:  5,
+			wantDepth: 3,
+			wantHoles: 3,
+			wantCost:  5.5,
+		},
+	}
+	cost := WeightedCost(map[*Symbol]float64{mult: 3, exp: 0.5}, 1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.target.Size(); got != tt.wantSize {
+				t.Errorf("ProgramTree.Size() = %d, want %d", got, tt.wantSize)
+			}
+			if got := tt.target.Depth(); got != tt.wantDepth {
+				t.Errorf("ProgramTree.Depth() = %d, want %d", got, tt.wantDepth)
+			}
+			if got := tt.target.Holes(); got != tt.wantHoles {
+				t.Errorf("ProgramTree.Holes() = %d, want %d", got, tt.wantHoles)
+			}
+			if got := tt.target.Cost(cost); got != tt.wantCost {
+				t.Errorf("ProgramTree.Cost() = %v, want %v", got, tt.wantCost)
+			}
+			if got := tt.target.Cost(SizeCost); got != float64(tt.wantSize) {
+				t.Errorf("ProgramTree.Cost(SizeCost) = %v, want %v", got, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestProgramTree_Metrics_Cache(t *testing.T) {
+	exp := NewSymbol("exp")
+	exp.isTerminal = false
+	plus := NewSymbol("add")
+	cnst := NewSymbol("const")
+
+	tree := NewProgramTree(plus)
+	tree.AddChildren(NewProgramTree(exp))
+	if got := tree.Holes(); got != 1 {
+		t.Fatalf("ProgramTree.Holes() = %d, want %d", got, 1)
+	}
+	tree.Replace(Path{0}, NewProgramTree(cnst).With(1))
+	if got := tree.Holes(); got != 0 {
+		t.Errorf("ProgramTree.Holes() = %d after filling the hole, want %d", got, 0)
+	}
+	tree.Insert(Path{1}, NewProgramTree(exp))
+	if got := tree.Size(); got != 3 {
+		t.Errorf("ProgramTree.Size() = %d after the insertion, want %d", got, 3)
+	}
+	tree.Children[1].AddChildren(NewProgramTree(exp), NewProgramTree(exp))
+	if got := tree.Holes(); got != 2 {
+		t.Errorf("ProgramTree.Holes() = %d after modifying a child, want %d", got, 2)
+	}
+	if got := tree.Depth(); got != 3 {
+		t.Errorf("ProgramTree.Depth() = %d after modifying a child, want %d", got, 3)
+	}
+}
+
+func TestProgramTree_Histogram(t *testing.T) {
+	plus := NewSymbol("add")
+	mult := NewSymbol("mult")
+	cnst := NewSymbol("const")
+
+	got := newPathTestTree(plus, mult, cnst).Histogram()
+	want := map[*Symbol]int{plus: 1, mult: 1, cnst: 3}
+	if len(got) != len(want) {
+		t.Fatalf("ProgramTree.Histogram() = %v, want %v", got, want)
+	}
+	for s, n := range want {
+		if got[s] != n {
+			t.Errorf("ProgramTree.Histogram()[%v] = %d, want %d", s, got[s], n)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package dsl
+
+// Simplifier rewrites a tree into an equivalent simpler one, like x0 + 0
+// into x0, and may modify the tree it is given.
+type Simplifier func(*ProgramTree) *ProgramTree
+
+// PartialEval returns the tree where the closed subtrees, of pure symbols
+// and symbols without semantics, are folded into the nodes of the constant
+// symbol, like minus(4, 2) into const(2), and the open subtrees left are
+// simplified by simplify unless it is nil. The tree is not modified.
+func (s *Semantics) PartialEval(t *ProgramTree, constant *Symbol, simplify Simplifier) *ProgramTree {
+	ret := s.foldConstants(t, constant)
+	if simplify == nil {
+		return ret
+	}
+	// simplifying may leave new closed subtrees, like x0 * 0 + 1
+	return s.foldConstants(simplify(ret), constant)
+}
+
+// foldConstants returns the copy of the tree with the closed subtrees
+// folded. A subtree is folded at the highest node the grammar allows a
+// constant at, and not if it fails without arguments or its value is a
+// closure.
+func (s *Semantics) foldConstants(t *ProgramTree, constant *Symbol) *ProgramTree {
+	// whether every node is closed, with only pure symbols and no holes
+	closedness := make(map[*ProgramTree]bool)
+	Fold(t, func(n *ProgramTree, children []bool) bool {
+		c := s.isPure(n.Symbol) || s.isPassThrough(n.Symbol)
+		if len(n.Children) == 0 {
+			_, ok := n.Value()
+			c = c && n.Symbol.IsTerminal() && ok
+		}
+		for _, child := range children {
+			c = c && child
+		}
+		closedness[n] = c
+		return c
+	})
+
+	evaluator := s.Evaluator()
+	fold := func(n *ProgramTree) (*ProgramTree, bool) {
+		if !closedness[n] || n.Symbol == constant {
+			return nil, false
+		}
+		val, ok := evaluator.Eval(n, NewEnv()).Value()
+		if _, isClosure := val.(*Closure); !ok || isClosure {
+			return nil, false
+		}
+		return NewProgramTree(constant).With(val), true
+	}
+
+	var rebuild func(n *ProgramTree) *ProgramTree
+	rebuild = func(n *ProgramTree) *ProgramTree {
+		children := make([]*ProgramTree, len(n.Children))
+		copy(children, n.Children)
+		for i, c := range children {
+			if s.allowsConstant(n.Symbol, children, i, constant) {
+				if folded, ok := fold(c); ok {
+					children[i] = folded
+					continue
+				}
+			}
+			children[i] = rebuild(c)
+		}
+		return &ProgramTree{Symbol: n.Symbol, Children: children, value: n.value}
+	}
+
+	if s.allowsConstantAtRoot(t.Symbol, constant) {
+		if folded, ok := fold(t); ok {
+			return folded
+		}
+	}
+	return rebuild(t)
+}
+
+// allowsConstant reports whether a rule of the symbol has the constant at i
+// with the other children, which may be folded later.
+func (s *Semantics) allowsConstant(symbol *Symbol, children []*ProgramTree, i int, constant *Symbol) bool {
+	for _, seq := range s.grammar.GetRhs(symbol) {
+		if len(seq) != len(children) || seq[i] != constant {
+			continue
+		}
+		match := true
+		for j, c := range children {
+			if j != i && seq[j] != c.Symbol && !(j > i && seq[j] == constant) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsConstantAtRoot reports whether the grammar allows the constant
+// wherever it has the symbol, since the parent of the root is unknown. The
+// start symbol is the root of a whole program, which isn't folded.
+func (s *Semantics) allowsConstantAtRoot(symbol, constant *Symbol) bool {
+	if symbol == s.grammar.GetStart() {
+		return false
+	}
+	found := false
+	for _, right := range s.grammar.rules.ruleMap {
+		seqs := right.getAllSeqs()
+		for _, seq := range seqs {
+			for i, sym := range seq {
+				if sym != symbol {
+					continue
+				}
+				found = true
+				if !hasConstantAt(seqs, seq, i, constant) {
+					return false
+				}
+			}
+		}
+	}
+	return found
+}
+
+// hasConstantAt reports whether seqs has the sequence with the constant at
+// i instead.
+func hasConstantAt(seqs [][]*Symbol, seq []*Symbol, i int, constant *Symbol) bool {
+	for _, other := range seqs {
+		if len(other) != len(seq) || other[i] != constant {
+			continue
+		}
+		match := true
+		for j := range seq {
+			if j != i && other[j] != seq[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// isPassThrough reports whether the symbol has no semantics, which passes
+// through the value of the only child.
+func (s *Semantics) isPassThrough(symbol *Symbol) bool {
+	_, isFunc := s.funcs[symbol]
+	_, isLeaf := s.leaves[symbol]
+	_, isForm := s.forms[symbol]
+	return !isFunc && !isLeaf && !isForm
+}
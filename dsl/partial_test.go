@@ -0,0 +1,108 @@
+package dsl
+
+import "testing"
+
+func TestSemantics_PartialEval(t *testing.T) {
+	g := newExpGrammar()
+	newSemantics := func() *Semantics {
+		return NewSemantics(&g.gram).
+			Register(g.plus, Binary(func(a, b int) int { return a + b })).
+			Register(g.mult, Binary(func(a, b int) int { return a * b })).
+			RegisterLeaf(g.cnst, Constant).
+			RegisterLeaf(g.param, Argument)
+	}
+	root := func(e *PGM) *PGM {
+		return &PGM{Symbol: g.S, Children: []*PGM{e}}
+	}
+	c := func(v int) *PGM { return g.leaf(g.cnst, v) }
+	x := g.leaf(g.param, 0)
+
+	tests := []struct {
+		name      string
+		semantics *Semantics
+		pgm       *PGM
+		want      string
+	}{
+		{
+			name:      "(1+4)*x0",
+			semantics: newSemantics().MarkPure(),
+			pgm:       root(g.node(g.mult, g.node(g.plus, c(1), c(4)), x)),
+			want:      `S[exp[mult[exp["const"(5)],exp["param"(0)]]]]`,
+		},
+		{
+			name:      "closed program",
+			semantics: newSemantics().MarkPure(),
+			pgm:       root(g.node(g.mult, g.node(g.plus, c(1), c(4)), c(3))),
+			want:      `S[exp["const"(15)]]`,
+		},
+		{
+			// exp has add and const
+			name:      "subtree",
+			semantics: newSemantics().MarkPure(),
+			pgm:       g.node(g.plus, c(1), c(4)).Children[0],
+			want:      `"const"(5)`,
+		},
+		{
+			// S and add have exp but not const
+			name:      "subtree of exp",
+			semantics: newSemantics().MarkPure(),
+			pgm:       g.node(g.plus, c(1), c(4)),
+			want:      `exp["const"(5)]`,
+		},
+		{
+			name:      "hole",
+			semantics: newSemantics().MarkPure(),
+			pgm:       root(g.node(g.plus, c(1), &PGM{Symbol: g.exp})),
+			want:      `S[exp[add[exp["const"(1)],exp]]]`,
+		},
+		{
+			name:      "impure symbol",
+			semantics: newSemantics().MarkPure(g.cnst, g.mult),
+			pgm:       root(g.node(g.mult, g.node(g.plus, c(1), c(4)), g.node(g.mult, c(2), c(3)))),
+			want:      `S[exp[mult[exp[add[exp["const"(1)],exp["const"(4)]]],exp["const"(6)]]]]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.pgm.String()
+			got := tt.semantics.PartialEval(tt.pgm, g.cnst, nil)
+			if got.String() != tt.want {
+				t.Errorf("Semantics.PartialEval() = %v, want %v", got, tt.want)
+			}
+			if tt.pgm.String() != before {
+				t.Errorf("Semantics.PartialEval() modifies the tree to %v", tt.pgm)
+			}
+			evaluator := tt.semantics.Evaluator()
+			env := NewEnv(7)
+			if a, b := evaluator.Eval(tt.pgm, env), evaluator.Eval(got, env); a.value != b.value {
+				t.Errorf("Evaluator.Eval() = %v after the partial evaluation, want %v", b, a)
+			}
+		})
+	}
+}
+
+func TestSemantics_PartialEval_Let(t *testing.T) {
+	g := newExpGrammar()
+	semantics := NewSemantics(&g.gram).
+		Register(g.plus, Binary(func(a, b int) int { return a + b })).
+		RegisterLeaf(g.cnst, Constant).
+		RegisterLeaf(g.v, Variable).
+		RegisterForm(g.let, Let).
+		MarkPure()
+	x := &PGM{Symbol: g.v, value: "x"}
+	one := &PGM{Symbol: g.cnst, value: 1}
+
+	// let x = 1 in x + x, and a free x
+	closed := g.letIn("x", one, g.add(x, x))
+	open := g.letIn("x", one, g.add(x, &PGM{Symbol: g.v, value: "y"}))
+	tree := &PGM{Symbol: g.S, Children: []*PGM{
+		&PGM{Symbol: g.exp, Children: []*PGM{g.add(
+			&PGM{Symbol: g.exp, Children: []*PGM{closed}},
+			&PGM{Symbol: g.exp, Children: []*PGM{open}},
+		)}},
+	}}
+	want := `S[exp[add[exp["const"(2)],exp[let(x)["const"(1),add["var"(x),"var"(y)]]]]]]`
+	if got := semantics.PartialEval(tree, g.cnst, nil); got.String() != want {
+		t.Errorf("Semantics.PartialEval() = %v, want %v", got, want)
+	}
+}
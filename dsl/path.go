@@ -0,0 +1,299 @@
+package dsl
+
+import (
+	"fmt"
+	"iter"
+	"strconv"
+	"strings"
+)
+
+// Path addresses a node by the child indexes on the way from the root.
+type Path []int
+
+func (p Path) Child(i int) Path {
+	cpy := make(Path, len(p), len(p)+1)
+	copy(cpy, p)
+	return append(cpy, i)
+}
+
+// Clone returns a copy of the path, which keeps a path given by a
+// traversal after the traversal moves on.
+func (p Path) Clone() Path {
+	cpy := make(Path, len(p))
+	copy(cpy, p)
+	return cpy
+}
+
+// pathBuffer is the path of a depth-first traversal, extended and truncated
+// in place so that the traversal doesn't allocate a path per node.
+type pathBuffer struct {
+	path Path
+}
+
+func (b *pathBuffer) push(i int) {
+	b.path = append(b.path, i)
+}
+
+func (b *pathBuffer) pop() {
+	b.path = b.path[:len(b.path)-1]
+}
+
+// get returns the current path, capped so that appending to it doesn't
+// write to the buffer.
+func (b *pathBuffer) get() Path {
+	return b.path[:len(b.path):len(b.path)]
+}
+
+func (p Path) String() string {
+	strs := make([]string, len(p))
+	for i, idx := range p {
+		strs[i] = strconv.Itoa(idx)
+	}
+	return "/" + strings.Join(strs, "/")
+}
+
+func (n *ProgramTree) Get(p Path) (*ProgramTree, bool) {
+	node := n
+	for _, i := range p {
+		if i < 0 || i >= len(node.Children) {
+			return nil, false
+		}
+		node = node.Children[i]
+	}
+	return node, true
+}
+
+// Replace replaces the node at the path with sub and returns the root of
+// the result, which is sub itself for the empty path. It panics if the path
+// is out of range.
+func (n *ProgramTree) Replace(p Path, sub *ProgramTree) *ProgramTree {
+	if len(p) == 0 {
+		return sub
+	}
+	parent := n.parentOf(p)
+	parent.Children[p[len(p)-1]] = sub
+	return n
+}
+
+// Insert inserts sub so that it is found at the path afterwards, shifting
+// the following siblings. It panics if the path is out of range.
+func (n *ProgramTree) Insert(p Path, sub *ProgramTree) {
+	if len(p) == 0 {
+		panic("dsl: cannot insert at the root")
+	}
+	parent := n.walk(p[:len(p)-1])
+	i := p[len(p)-1]
+	if i < 0 || i > len(parent.Children) {
+		panic(fmt.Sprintf("dsl: path index %d out of range of %s", i, parent))
+	}
+	parent.Children = append(parent.Children, nil)
+	copy(parent.Children[i+1:], parent.Children[i:])
+	parent.Children[i] = sub
+}
+
+// Delete removes the node at the path and returns it. It panics if the
+// path is out of range.
+func (n *ProgramTree) Delete(p Path) *ProgramTree {
+	if len(p) == 0 {
+		panic("dsl: cannot delete the root")
+	}
+	parent := n.parentOf(p)
+	i := p[len(p)-1]
+	removed := parent.Children[i]
+	parent.Children = append(parent.Children[:i], parent.Children[i+1:]...)
+	return removed
+}
+
+func (n *ProgramTree) parentOf(p Path) *ProgramTree {
+	parent := n.walk(p[:len(p)-1])
+	if i := p[len(p)-1]; i < 0 || i >= len(parent.Children) {
+		panic(fmt.Sprintf("dsl: path index %d out of range of %s", i, parent))
+	}
+	return parent
+}
+
+// walk returns the node at the path.
+func (n *ProgramTree) walk(p Path) *ProgramTree {
+	node := n
+	for _, i := range p {
+		if i < 0 || i >= len(node.Children) {
+			panic(fmt.Sprintf("dsl: path index %d out of range of %s", i, node))
+		}
+		node = node.Children[i]
+	}
+	return node
+}
+
+func (n *ProgramTree) LeafPaths() []Path {
+	ret := make([]Path, 0)
+	for p, node := range n.PreOrder() {
+		if len(node.Children) == 0 {
+			ret = append(ret, p.Clone())
+		}
+	}
+	return ret
+}
+
+func (n *ProgramTree) NonTerminalLeafPaths() []Path {
+	ret := make([]Path, 0)
+	for p, node := range n.PreOrder() {
+		if len(node.Children) == 0 && !node.Symbol.IsTerminal() {
+			ret = append(ret, p.Clone())
+		}
+	}
+	return ret
+}
+
+// PreOrder iterates the nodes with their paths, where a path is reused for
+// the next nodes and must be cloned to be kept.
+func (n *ProgramTree) PreOrder() iter.Seq2[Path, *ProgramTree] {
+	return func(yield func(Path, *ProgramTree) bool) {
+		n.preOrder(&pathBuffer{path: Path{}}, yield)
+	}
+}
+
+func (n *ProgramTree) preOrder(buf *pathBuffer, yield func(Path, *ProgramTree) bool) bool {
+	if !yield(buf.get(), n) {
+		return false
+	}
+	for i, c := range n.Children {
+		buf.push(i)
+		ok := c.preOrder(buf, yield)
+		buf.pop()
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// PostOrder iterates the nodes with their paths, where a path is reused for
+// the next nodes and must be cloned to be kept.
+func (n *ProgramTree) PostOrder() iter.Seq2[Path, *ProgramTree] {
+	return func(yield func(Path, *ProgramTree) bool) {
+		n.postOrder(&pathBuffer{path: Path{}}, yield)
+	}
+}
+
+func (n *ProgramTree) postOrder(buf *pathBuffer, yield func(Path, *ProgramTree) bool) bool {
+	for i, c := range n.Children {
+		buf.push(i)
+		ok := c.postOrder(buf, yield)
+		buf.pop()
+		if !ok {
+			return false
+		}
+	}
+	return yield(buf.get(), n)
+}
+
+func (n *ProgramTree) BreadthFirst() iter.Seq2[Path, *ProgramTree] {
+	return func(yield func(Path, *ProgramTree) bool) {
+		type entry struct {
+			path Path
+			node *ProgramTree
+		}
+		queue := []entry{{Path{}, n}}
+		for len(queue) > 0 {
+			e := queue[0]
+			queue = queue[1:]
+			if !yield(e.path, e.node) {
+				return
+			}
+			for i, c := range e.node.Children {
+				queue = append(queue, entry{e.path.Child(i), c})
+			}
+		}
+	}
+}
+
+// Cursor navigates a tree like a zipper, keeping the ancestors of the
+// current node so that moving up and to the siblings is O(1).
+type Cursor struct {
+	node      *ProgramTree
+	ancestors []*ProgramTree
+	path      Path
+}
+
+func NewCursor(root *ProgramTree) *Cursor {
+	return &Cursor{
+		node: root,
+		path: Path{},
+	}
+}
+
+func (c *Cursor) Node() *ProgramTree {
+	return c.node
+}
+
+func (c *Cursor) Path() Path {
+	cpy := make(Path, len(c.path))
+	copy(cpy, c.path)
+	return cpy
+}
+
+func (c *Cursor) Root() *ProgramTree {
+	if len(c.ancestors) == 0 {
+		return c.node
+	}
+	return c.ancestors[0]
+}
+
+func (c *Cursor) Parent() (*ProgramTree, bool) {
+	if len(c.ancestors) == 0 {
+		return nil, false
+	}
+	return c.ancestors[len(c.ancestors)-1], true
+}
+
+func (c *Cursor) Down(i int) bool {
+	if i < 0 || i >= len(c.node.Children) {
+		return false
+	}
+	c.ancestors = append(c.ancestors, c.node)
+	c.path = append(c.path, i)
+	c.node = c.node.Children[i]
+	return true
+}
+
+func (c *Cursor) Up() bool {
+	parent, ok := c.Parent()
+	if !ok {
+		return false
+	}
+	c.ancestors = c.ancestors[:len(c.ancestors)-1]
+	c.path = c.path[:len(c.path)-1]
+	c.node = parent
+	return true
+}
+
+func (c *Cursor) Next() bool {
+	return c.sibling(1)
+}
+
+func (c *Cursor) Prev() bool {
+	return c.sibling(-1)
+}
+
+func (c *Cursor) sibling(offset int) bool {
+	parent, ok := c.Parent()
+	if !ok {
+		return false
+	}
+	i := c.path[len(c.path)-1] + offset
+	if i < 0 || i >= len(parent.Children) {
+		return false
+	}
+	c.path[len(c.path)-1] = i
+	c.node = parent.Children[i]
+	return true
+}
+
+// Replace replaces the current node in its parent, or the root itself when
+// the cursor is at the root.
+func (c *Cursor) Replace(sub *ProgramTree) {
+	if parent, ok := c.Parent(); ok {
+		parent.Children[c.path[len(c.path)-1]] = sub
+	}
+	c.node = sub
+}
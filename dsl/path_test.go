@@ -0,0 +1,248 @@
+package dsl
+
+import (
+	"reflect"
+	"testing"
+)
+
+// (1+4)*3
+func newPathTestTree(plus, mult, cnst *Symbol) *PGM {
+	return &PGM{
+		Symbol: mult, Children: []*PGM{
+			&PGM{
+				Symbol: plus, Children: []*PGM{
+					&PGM{Symbol: cnst, value: 1},
+					&PGM{Symbol: cnst, value: 4},
+				},
+			},
+			&PGM{Symbol: cnst, value: 3},
+		},
+	}
+}
+
+func TestProgramTree_Get(t *testing.T) {
+	plus := NewSymbol("add")
+	mult := NewSymbol("mult")
+	cnst := NewSymbol("const")
+	tree := newPathTestTree(plus, mult, cnst)
+
+	tests := []struct {
+		name   string
+		path   Path
+		want   string
+		wantOk bool
+	}{
+		{name: "root", path: Path{}, want: tree.String(), wantOk: true},
+		{name: "inner", path: Path{0}, want: `"add"["const"(1),"const"(4)]`, wantOk: true},
+		{name: "leaf", path: Path{0, 1}, want: `"const"(4)`, wantOk: true},
+		{name: "out of range", path: Path{2}, wantOk: false},
+		{name: "below a leaf", path: Path{1, 0}, wantOk: false},
+		{name: "negative", path: Path{-1}, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tree.Get(tt.path)
+			if ok != tt.wantOk {
+				t.Fatalf("ProgramTree.Get() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && got.String() != tt.want {
+				t.Errorf("ProgramTree.Get() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProgramTree_Edit(t *testing.T) {
+	plus := NewSymbol("add")
+	mult := NewSymbol("mult")
+	cnst := NewSymbol("const")
+
+	tests := []struct {
+		name string
+		edit func(*PGM) *PGM
+		want string
+	}{
+		{
+			name: "replace a leaf",
+			edit: func(tree *PGM) *PGM {
+				return tree.Replace(Path{0, 0}, NewProgramTree(cnst).With(7))
+			},
+			want: `"mult"["add"["const"(7),"const"(4)],"const"(3)]`,
+		},
+		{
+			name: "replace the root",
+			edit: func(tree *PGM) *PGM {
+				return tree.Replace(Path{}, NewProgramTree(cnst).With(7))
+			},
+			want: `"const"(7)`,
+		},
+		{
+			name: "insert in the middle",
+			edit: func(tree *PGM) *PGM {
+				tree.Insert(Path{0, 1}, NewProgramTree(cnst).With(7))
+				return tree
+			},
+			want: `"mult"["add"["const"(1),"const"(7),"const"(4)],"const"(3)]`,
+		},
+		{
+			name: "insert at the end",
+			edit: func(tree *PGM) *PGM {
+				tree.Insert(Path{2}, NewProgramTree(cnst).With(7))
+				return tree
+			},
+			want: `"mult"["add"["const"(1),"const"(4)],"const"(3),"const"(7)]`,
+		},
+		{
+			name: "delete a subtree",
+			edit: func(tree *PGM) *PGM {
+				tree.Delete(Path{0})
+				return tree
+			},
+			want: `"mult"["const"(3)]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newPathTestTree(plus, mult, cnst)
+			tree.Hash()
+			got := tt.edit(tree)
+			if got.String() != tt.want {
+				t.Errorf("edited tree = %v, want %v", got, tt.want)
+			}
+			if got.Hash() != got.Clone().Hash() {
+				t.Errorf("the hash is stale after the edit")
+			}
+		})
+	}
+
+	t.Run("invalid path", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("ProgramTree.Delete() does not panic with an invalid path")
+			}
+		}()
+		newPathTestTree(plus, mult, cnst).Delete(Path{0, 2})
+	})
+}
+
+func TestProgramTree_Traversal(t *testing.T) {
+	plus := NewSymbol("add")
+	mult := NewSymbol("mult")
+	cnst := NewSymbol("const")
+	tree := newPathTestTree(plus, mult, cnst)
+
+	collect := func(seq func(func(Path, *PGM) bool)) []string {
+		ret := make([]string, 0)
+		for p, _ := range seq {
+			ret = append(ret, p.String())
+		}
+		return ret
+	}
+
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{
+			name: "pre-order",
+			got:  collect(tree.PreOrder()),
+			want: []string{"/", "/0", "/0/0", "/0/1", "/1"},
+		},
+		{
+			name: "post-order",
+			got:  collect(tree.PostOrder()),
+			want: []string{"/0/0", "/0/1", "/0", "/1", "/"},
+		},
+		{
+			name: "breadth-first",
+			got:  collect(tree.BreadthFirst()),
+			want: []string{"/", "/0", "/1", "/0/0", "/0/1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("traversal = %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+
+	t.Run("early stop", func(t *testing.T) {
+		count := 0
+		for range tree.PreOrder() {
+			count++
+			if count == 2 {
+				break
+			}
+		}
+		if count != 2 {
+			t.Errorf("the iteration does not stop")
+		}
+	})
+
+	t.Run("appending to a path", func(t *testing.T) {
+		got := make([]string, 0)
+		for p := range tree.PreOrder() {
+			_ = append(p, 9)
+			got = append(got, p.String())
+		}
+		want := []string{"/", "/0", "/0/0", "/0/1", "/1"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("traversal = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("no path per node", func(t *testing.T) {
+		// (((c+c)+c)+...)+c of a hundred additions
+		deep := &PGM{Symbol: cnst, value: 1}
+		for i := 0; i < 100; i++ {
+			deep = &PGM{Symbol: plus, Children: []*PGM{deep, &PGM{Symbol: cnst, value: 1}}}
+		}
+		allocs := testing.AllocsPerRun(10, func() {
+			for range deep.PreOrder() {
+			}
+			for range deep.PostOrder() {
+			}
+			Walk(VisitorFuncs{}, deep)
+		})
+		if allocs > 50 {
+			t.Errorf("traversals of %d nodes allocate %v times", deep.Size(), allocs)
+		}
+	})
+}
+
+func TestCursor(t *testing.T) {
+	plus := NewSymbol("add")
+	mult := NewSymbol("mult")
+	cnst := NewSymbol("const")
+	tree := newPathTestTree(plus, mult, cnst)
+
+	c := NewCursor(tree)
+	if c.Up() || c.Next() {
+		t.Errorf("Cursor moves beyond the root")
+	}
+	if !c.Down(0) || !c.Down(1) {
+		t.Fatalf("Cursor.Down() fails")
+	}
+	if got := c.Path().String(); got != "/0/1" {
+		t.Errorf("Cursor.Path() = %v, want %v", got, "/0/1")
+	}
+	if c.Next() {
+		t.Errorf("Cursor.Next() moves beyond the last sibling")
+	}
+	if !c.Prev() || c.Node().String() != `"const"(1)` {
+		t.Errorf("Cursor.Prev() = %v, want %v", c.Node(), `"const"(1)`)
+	}
+	if parent, _ := c.Parent(); parent.Symbol != plus {
+		t.Errorf("Cursor.Parent() = %v, want %v", parent, plus)
+	}
+
+	c.Replace(NewProgramTree(cnst).With(9))
+	if !c.Up() || !c.Next() || c.Node().String() != `"const"(3)` {
+		t.Errorf("Cursor.Next() = %v, want %v", c.Node(), `"const"(3)`)
+	}
+	if got, want := c.Root().String(), `"mult"["add"["const"(9),"const"(4)],"const"(3)]`; got != want {
+		t.Errorf("Cursor.Root() = %v, want %v", got, want)
+	}
+}
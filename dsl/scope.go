@@ -0,0 +1,134 @@
+package dsl
+
+import (
+	"fmt"
+	"slices"
+)
+
+// scope is an immutable list of bindings shared by the Envs extending it.
+type scope struct {
+	name   string
+	value  Value
+	parent *scope
+}
+
+// Extend returns the Env binding the name to the value in a nested scope,
+// leaving the Env unchanged.
+func (e Env) Extend(name string, value Value) Env {
+	e.scope = &scope{name: name, value: value, parent: e.scope}
+	return e
+}
+
+// Lookup returns the value of the innermost binding of the name.
+func (e Env) Lookup(name string) (Value, bool) {
+	for s := e.scope; s != nil; s = s.parent {
+		if s.name == name {
+			return s.value, true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the names in scope from the innermost one.
+func (e Env) Names() []string {
+	ret := make([]string, 0)
+	for s := e.scope; s != nil; s = s.parent {
+		if !slices.Contains(ret, s.name) {
+			ret = append(ret, s.name)
+		}
+	}
+	return ret
+}
+
+// Variable is the LeafFunc of the nodes whose value is the name of a
+// variable in scope.
+func Variable(node *ProgramTree, env Env) (Value, error) {
+	name, ok := ValueOf[string](node)
+	if !ok {
+		return nil, NewEvalError(MissingValue, node, "%s doesn't have the name", node.Symbol)
+	}
+	val, ok := env.Lookup(name)
+	if !ok {
+		return nil, NewEvalError(Unbound, node, "%s is not in scope", name)
+	}
+	return val, nil
+}
+
+// Let is the FormFunc of the nodes binding the name of their value to the
+// first child in the second child.
+func Let(node *ProgramTree, env Env, eval func(i int, env Env) EvalResult) EvalResult {
+	name, ok := ValueOf[string](node)
+	if !ok {
+		return NewEvalErrorResult(NewEvalError(MissingValue, node, "%s doesn't have the name", node.Symbol))
+	}
+	if len(node.Children) != 2 {
+		return NewEvalErrorResult(NewEvalError(Failure, node, "%s has %d children, not 2", node.Symbol, len(node.Children)))
+	}
+	r := eval(0, env)
+	val, ok := r.Value()
+	if !ok {
+		return r
+	}
+	return eval(1, env.Extend(name, val))
+}
+
+// Scoping declares the symbols binding names, which are the string values
+// of their nodes, so that the names in scope are known at every path.
+type Scoping struct {
+	binders map[*Symbol][]int
+}
+
+func NewScoping() *Scoping {
+	return &Scoping{
+		binders: make(map[*Symbol][]int),
+	}
+}
+
+// Bind declares that the nodes of the symbol bind the name in the children
+// of the indexes, like Bind(let, 1) for Let.
+func (sc *Scoping) Bind(s *Symbol, body ...int) *Scoping {
+	sc.binders[s] = body
+	return sc
+}
+
+func (sc *Scoping) IsBinder(s *Symbol) bool {
+	_, ok := sc.binders[s]
+	return ok
+}
+
+// walkBinders calls f with the binders above the path whose body contains it.
+func (sc *Scoping) walkBinders(root *ProgramTree, p Path, f func(*ProgramTree)) {
+	n := root
+	for _, i := range p {
+		if i < 0 || i >= len(n.Children) {
+			panic(fmt.Sprintf("dsl: invalid path %s", p))
+		}
+		if body, ok := sc.binders[n.Symbol]; ok && slices.Contains(body, i) {
+			f(n)
+		}
+		n = n.Children[i]
+	}
+}
+
+// Scope returns the names in scope at the path from the innermost one.
+func (sc *Scoping) Scope(root *ProgramTree, p Path) []string {
+	ret := make([]string, 0)
+	sc.walkBinders(root, p, func(n *ProgramTree) {
+		name, ok := ValueOf[string](n)
+		if ok && !slices.Contains(ret, name) {
+			ret = append(ret, name)
+		}
+	})
+	slices.Reverse(ret)
+	return ret
+}
+
+// FreshName returns the name for a binder at the path, which is distinct
+// from the names of the binders it is nested in.
+func (sc *Scoping) FreshName(root *ProgramTree, p Path) string {
+	depth := 0
+	sc.walkBinders(root, p, func(*ProgramTree) {
+		depth++
+	})
+	return fmt.Sprintf("v%d", depth)
+}
@@ -0,0 +1,143 @@
+package dsl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnv_Extend(t *testing.T) {
+	root := NewEnv(1)
+	outer := root.Extend("x", 1).Extend("y", 2)
+	inner := outer.Extend("x", 3)
+
+	tests := []struct {
+		name   string
+		env    Env
+		lookup string
+		want   Value
+		wantOk bool
+	}{
+		{name: "unbound in the root", env: root, lookup: "x", wantOk: false},
+		{name: "outer", env: outer, lookup: "x", want: 1, wantOk: true},
+		{name: "shadowed", env: inner, lookup: "x", want: 3, wantOk: true},
+		{name: "shared with the parent", env: inner, lookup: "y", want: 2, wantOk: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.env.Lookup(tt.lookup)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("Env.Lookup() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+	if got, want := inner.Names(), []string{"x", "y"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Env.Names() = %v, want %v", got, want)
+	}
+	if arg, _ := inner.Arg(0); arg != 1 {
+		t.Errorf("Env.Arg() = %v, want %v", arg, 1)
+	}
+}
+
+func (g expGrammar) letIn(name string, bound, body *PGM) *PGM {
+	return &PGM{Symbol: g.let, value: name, Children: []*PGM{bound, body}}
+}
+
+func (g expGrammar) add(a, b *PGM) *PGM {
+	return &PGM{Symbol: g.plus, Children: []*PGM{a, b}}
+}
+
+func TestLet(t *testing.T) {
+	g := newExpGrammar()
+	evaluator := NewSemantics(&g.gram).
+		Register(g.plus, Binary(func(a, b int) int { return a + b })).
+		RegisterLeaf(g.cnst, Constant).
+		RegisterLeaf(g.v, Variable).
+		RegisterForm(g.let, Let).
+		MarkPure().
+		Evaluator()
+	x := &PGM{Symbol: g.v, value: "x"}
+	y := &PGM{Symbol: g.v, value: "y"}
+	one := &PGM{Symbol: g.cnst, value: 1}
+	ten := &PGM{Symbol: g.cnst, value: 10}
+
+	tests := []struct {
+		name     string
+		pgm      *PGM
+		want     int
+		wantKind ErrorKind
+		wantErr  bool
+	}{
+		{name: "let x = 1 in x + x", pgm: g.letIn("x", one, g.add(x, x)), want: 2},
+		{
+			name: "let x = 1 in let x = 10 in x + x",
+			pgm:  g.letIn("x", one, g.letIn("x", ten, g.add(x, x))),
+			want: 20,
+		},
+		{
+			name: "let x = 1 in let y = x + 10 in x + y",
+			pgm:  g.letIn("x", one, g.letIn("y", g.add(x, ten), g.add(x, y))),
+			want: 12,
+		},
+		{
+			name:     "let x = y in x",
+			pgm:      g.letIn("x", y, x),
+			wantKind: Unbound,
+			wantErr:  true,
+		},
+		{
+			name:     "(let x = 1 in x) + x",
+			pgm:      g.add(g.letIn("x", one, x), x),
+			wantKind: Unbound,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewEvalCache(100)
+			results := map[string]EvalResult{
+				"Evaluator.Eval()": evaluator.Eval(tt.pgm, NewEnv().WithCache(cache)),
+				"Program.Run()":    evaluator.Compile(tt.pgm).Run(NewEnv().WithCache(cache)),
+			}
+			for name, got := range results {
+				if tt.wantErr {
+					if !IsKind(got.Err(), tt.wantKind) {
+						t.Errorf("%s error = %v, want an error of %v", name, got.Err(), tt.wantKind)
+					}
+					continue
+				}
+				if val, _ := got.Value(); val != tt.want {
+					t.Errorf("%s = %v, want %v", name, val, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestScoping(t *testing.T) {
+	g := newExpGrammar()
+	scoping := NewScoping().Bind(g.let, 1)
+	hole := &PGM{Symbol: g.exp}
+	// let x = _ in let y = _ in _ + _
+	tree := g.letIn("x", hole, g.letIn("y", hole, g.add(hole, hole)))
+
+	tests := []struct {
+		name      string
+		path      Path
+		wantScope []string
+		wantFresh string
+	}{
+		{name: "bound expression", path: Path{0}, wantScope: []string{}, wantFresh: "v0"},
+		{name: "inner bound expression", path: Path{1, 0}, wantScope: []string{"x"}, wantFresh: "v1"},
+		{name: "inner body", path: Path{1, 1, 0}, wantScope: []string{"y", "x"}, wantFresh: "v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scoping.Scope(tree, tt.path); !reflect.DeepEqual(got, tt.wantScope) {
+				t.Errorf("Scoping.Scope() = %v, want %v", got, tt.wantScope)
+			}
+			if got := scoping.FreshName(tree, tt.path); got != tt.wantFresh {
+				t.Errorf("Scoping.FreshName() = %v, want %v", got, tt.wantFresh)
+			}
+		})
+	}
+}
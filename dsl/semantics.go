@@ -0,0 +1,272 @@
+package dsl
+
+import "errors"
+
+type Value = interface{}
+
+// SemanticFunc computes the value of a node from the values of its
+// children, where a nil value means no value.
+type SemanticFunc func(args ...Value) (Value, error)
+
+// LeafFunc computes the value of a node from the node itself, like a
+// constant or a parameter.
+type LeafFunc func(node *ProgramTree, env Env) (Value, error)
+
+// FormFunc computes the value of a node controlling the evaluation of its
+// children, where eval evaluates the i-th child in an Env, like a let
+// evaluating its body in an extended Env.
+type FormFunc func(node *ProgramTree, env Env, eval func(i int, env Env) EvalResult) EvalResult
+
+// Constant is the LeafFunc of the nodes whose value is the value itself.
+func Constant(node *ProgramTree, env Env) (Value, error) {
+	val, ok := node.Value()
+	if !ok {
+		return nil, NewEvalError(MissingValue, node, "%s doesn't have the value", node.Symbol)
+	}
+	return val, nil
+}
+
+// Argument is the LeafFunc of the nodes whose value is the index of an
+// argument in the Env.
+func Argument(node *ProgramTree, env Env) (Value, error) {
+	i, ok := ValueOf[int](node)
+	if !ok {
+		return nil, NewEvalError(MissingValue, node, "%s doesn't have the index", node.Symbol)
+	}
+	return env.Arg(i)
+}
+
+// Unary and Binary lift typed operations to SemanticFuncs that fail with
+// TypeMismatch on arguments of other types.
+func Unary[T, R any](f func(T) R) SemanticFunc {
+	return func(args ...Value) (Value, error) {
+		if len(args) != 1 {
+			return nil, NewEvalError(Failure, nil, "%d arguments for a unary operation", len(args))
+		}
+		a, ok := args[0].(T)
+		if !ok {
+			return nil, NewEvalError(TypeMismatch, nil, "%v is %T, not %T", args[0], args[0], a)
+		}
+		return f(a), nil
+	}
+}
+
+func Binary[T, R any](f func(T, T) R) SemanticFunc {
+	return func(args ...Value) (Value, error) {
+		if len(args) != 2 {
+			return nil, NewEvalError(Failure, nil, "%d arguments for a binary operation", len(args))
+		}
+		a, ok := args[0].(T)
+		if !ok {
+			return nil, NewEvalError(TypeMismatch, nil, "%v is %T, not %T", args[0], args[0], a)
+		}
+		b, ok := args[1].(T)
+		if !ok {
+			return nil, NewEvalError(TypeMismatch, nil, "%v is %T, not %T", args[1], args[1], b)
+		}
+		return f(a, b), nil
+	}
+}
+
+// Module is a set of semantics keyed by symbol id, which can be shared by
+// grammars with symbols of the same ids.
+type Module struct {
+	name   string
+	funcs  map[string]SemanticFunc
+	leaves map[string]LeafFunc
+	forms  map[string]FormFunc
+}
+
+func NewModule(name string) *Module {
+	return &Module{
+		name:   name,
+		funcs:  make(map[string]SemanticFunc),
+		leaves: make(map[string]LeafFunc),
+		forms:  make(map[string]FormFunc),
+	}
+}
+
+func (m *Module) Name() string {
+	return m.name
+}
+
+func (m *Module) Define(id string, f SemanticFunc) *Module {
+	m.funcs[id] = f
+	return m
+}
+
+func (m *Module) DefineLeaf(id string, f LeafFunc) *Module {
+	m.leaves[id] = f
+	return m
+}
+
+func (m *Module) DefineForm(id string, f FormFunc) *Module {
+	m.forms[id] = f
+	return m
+}
+
+// Semantics builds an Evaluator from semantics registered per symbol. The
+// children of a node are evaluated before its SemanticFunc, and a node of
+// a symbol without semantics takes the value of its only child, as S and
+// exp do.
+type Semantics struct {
+	grammar *Grammar
+	funcs   map[*Symbol]SemanticFunc
+	leaves  map[*Symbol]LeafFunc
+	forms   map[*Symbol]FormFunc
+	pure    bool
+	// pureSymbols are the symbols declared pure when not all are
+	pureSymbols map[*Symbol]struct{}
+}
+
+func NewSemantics(grammar *Grammar) *Semantics {
+	return &Semantics{
+		grammar:     grammar,
+		funcs:       make(map[*Symbol]SemanticFunc),
+		leaves:      make(map[*Symbol]LeafFunc),
+		forms:       make(map[*Symbol]FormFunc),
+		pureSymbols: make(map[*Symbol]struct{}),
+	}
+}
+
+func (s *Semantics) unregister(symbol *Symbol) {
+	delete(s.funcs, symbol)
+	delete(s.leaves, symbol)
+	delete(s.forms, symbol)
+}
+
+func (s *Semantics) Register(symbol *Symbol, f SemanticFunc) *Semantics {
+	s.unregister(symbol)
+	s.funcs[symbol] = f
+	return s
+}
+
+func (s *Semantics) RegisterLeaf(symbol *Symbol, f LeafFunc) *Semantics {
+	s.unregister(symbol)
+	s.leaves[symbol] = f
+	return s
+}
+
+func (s *Semantics) RegisterForm(symbol *Symbol, f FormFunc) *Semantics {
+	s.unregister(symbol)
+	s.forms[symbol] = f
+	return s
+}
+
+// Use registers the semantics of the module for the symbols of the grammar
+// with the same ids. The symbols the grammar doesn't have are ignored.
+func (s *Semantics) Use(m *Module) *Semantics {
+	for id, f := range m.funcs {
+		if symbol, ok := s.grammar.GetSymbol(id); ok {
+			s.Register(symbol, f)
+		}
+	}
+	for id, f := range m.leaves {
+		if symbol, ok := s.grammar.GetSymbol(id); ok {
+			s.RegisterLeaf(symbol, f)
+		}
+	}
+	for id, f := range m.forms {
+		if symbol, ok := s.grammar.GetSymbol(id); ok {
+			s.RegisterForm(symbol, f)
+		}
+	}
+	return s
+}
+
+// MarkPure declares that the semantics of the symbols depend only on the
+// children and the Env, or all the semantics without symbols. The results of
+// subtrees are memoized by the cache of the Env only if all are pure.
+func (s *Semantics) MarkPure(symbols ...*Symbol) *Semantics {
+	if len(symbols) == 0 {
+		s.pure = true
+		return s
+	}
+	for _, symbol := range symbols {
+		s.pureSymbols[symbol] = struct{}{}
+	}
+	return s
+}
+
+func (s *Semantics) isPure(symbol *Symbol) bool {
+	_, ok := s.pureSymbols[symbol]
+	return s.pure || ok
+}
+
+func (s *Semantics) Evaluator() Evaluator {
+	e := NewEvaluator(s.eval)
+	e.compileFunc = s.compile
+	return e
+}
+
+func (s *Semantics) eval(node *ProgramTree, env Env) EvalResult {
+	if s.pure {
+		return env.cached(node, func() EvalResult {
+			return s.step(node, env)
+		})
+	}
+	return s.step(node, env)
+}
+
+func (s *Semantics) step(node *ProgramTree, env Env) EvalResult {
+	if err := env.Enter(node); err != nil {
+		return NewEvalErrorResult(err)
+	}
+	ret := s.evalNode(node, env)
+	env.Leave(node, ret)
+	return ret
+}
+
+func (s *Semantics) evalNode(node *ProgramTree, env Env) EvalResult {
+	if f, ok := s.leaves[node.Symbol]; ok {
+		return s.result(node)(f(node, env))
+	}
+	f, ok := s.funcs[node.Symbol]
+	if len(node.Children) == 0 && !node.Symbol.IsTerminal() {
+		// a hole has no value
+		return NewEvalResult(nil)
+	}
+	if form, ok := s.forms[node.Symbol]; ok {
+		return form(node, env, func(i int, env Env) EvalResult {
+			return s.eval(node.Children[i], env.Child(i))
+		})
+	}
+	if !ok && len(node.Children) != 1 {
+		return NewEvalErrorResult(NewEvalError(Failure, node, "no semantics for %s", node.Symbol))
+	}
+
+	args := make([]Value, len(node.Children))
+	for i, c := range node.Children {
+		r := s.eval(c, env.Child(i))
+		val, ok := r.Value()
+		if !ok {
+			return r
+		}
+		args[i] = val
+	}
+	if !ok {
+		return NewEvalResult(args[0])
+	}
+	return s.result(node)(f(args...))
+}
+
+// result attributes the error of the semantics of the node to the node.
+func (s *Semantics) result(node *ProgramTree) func(Value, error) EvalResult {
+	return func(val Value, err error) EvalResult {
+		if err == nil {
+			return NewEvalResult(val)
+		}
+		var evalErr *EvalError
+		if !errors.As(err, &evalErr) {
+			wrapped := NewEvalError(Failure, node, "%v", err)
+			wrapped.Cause = err
+			return NewEvalErrorResult(wrapped)
+		}
+		if evalErr.Node == nil {
+			attributed := *evalErr
+			attributed.Node = node
+			return NewEvalErrorResult(&attributed)
+		}
+		return NewEvalErrorResult(err)
+	}
+}
@@ -0,0 +1,128 @@
+package dsl
+
+import (
+	"errors"
+	"testing"
+)
+
+var errDivByZero = errors.New("division by zero")
+
+func newArithModule() *Module {
+	return NewModule("arith").
+		Define("add", Binary(func(a, b int) int { return a + b })).
+		Define("div", func(args ...Value) (Value, error) {
+			if args[1].(int) == 0 {
+				return nil, errDivByZero
+			}
+			return args[0].(int) / args[1].(int), nil
+		}).
+		DefineLeaf("const", Constant).
+		DefineLeaf("param", Argument)
+}
+
+func TestSemantics_Use(t *testing.T) {
+	arith := newArithModule()
+
+	// two grammars with their own symbols share the module
+	for _, name := range []string{"first", "second"} {
+		t.Run(name, func(t *testing.T) {
+			S := NewSymbol("S")
+			plus := NewSymbol("add")
+			cnst := NewSymbol("const")
+			gram := NewGrammar(S)
+			gram.AddRule(S, plus)
+			gram.AddRule(plus, cnst, cnst)
+
+			evaluator := NewSemantics(&gram).Use(arith).Evaluator()
+			tree := &PGM{Symbol: S, Children: []*PGM{
+				&PGM{Symbol: plus, Children: []*PGM{
+					&PGM{Symbol: cnst, value: 1}, &PGM{Symbol: cnst, value: 4},
+				}},
+			}}
+			if got, _ := evaluator.Eval(tree, NewEnv()).Value(); got != 5 {
+				t.Errorf("Evaluator.Eval() = %v, want %v", got, 5)
+			}
+		})
+	}
+}
+
+func TestSemantics_Errors(t *testing.T) {
+	S := NewSymbol("S")
+	div := NewSymbol("div")
+	pair := NewSymbol("pair")
+	cnst := NewSymbol("const")
+	param := NewSymbol("param")
+	gram := NewGrammar(S)
+	gram.AddRule(S, div)
+	gram.AddRule(S, pair)
+	gram.AddRule(S, param)
+	gram.AddRule(div, cnst, cnst)
+	gram.AddRule(pair, cnst, cnst)
+
+	semantics := NewSemantics(&gram).Use(newArithModule())
+
+	tests := []struct {
+		name     string
+		pgm      *PGM
+		wantKind ErrorKind
+		wantPath string
+	}{
+		{
+			name: "error of the semantics",
+			pgm: &PGM{Symbol: S, Children: []*PGM{
+				&PGM{Symbol: div, Children: []*PGM{
+					&PGM{Symbol: cnst, value: 1}, &PGM{Symbol: cnst, value: 0},
+				}},
+			}},
+			wantKind: Failure,
+			wantPath: "/0",
+		},
+		{
+			name: "no semantics",
+			pgm: &PGM{Symbol: pair, Children: []*PGM{
+				&PGM{Symbol: cnst, value: 1}, &PGM{Symbol: cnst, value: 0},
+			}},
+			wantKind: Failure,
+			wantPath: "/",
+		},
+		{
+			name:     "missing argument",
+			pgm:      &PGM{Symbol: S, Children: []*PGM{&PGM{Symbol: param, value: 3}}},
+			wantKind: ArgOutOfRange,
+			wantPath: "/0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluator := semantics.Evaluator()
+			err := evaluator.Eval(tt.pgm, NewEnv()).Err()
+			var evalErr *EvalError
+			if !errors.As(err, &evalErr) || evalErr.Kind != tt.wantKind {
+				t.Fatalf("Evaluator.Eval() error = %v, want an error of %v", err, tt.wantKind)
+			}
+			if got := evalErr.Path.String(); got != tt.wantPath {
+				t.Errorf("EvalError.Path = %v, want %v", got, tt.wantPath)
+			}
+		})
+	}
+
+	t.Run("cause", func(t *testing.T) {
+		evaluator := semantics.Evaluator()
+		err := evaluator.Eval(tests[0].pgm, NewEnv()).Err()
+		if !errors.Is(err, errDivByZero) {
+			t.Errorf("Evaluator.Eval() error = %v, want %v", err, errDivByZero)
+		}
+	})
+
+	t.Run("panic of GetArg", func(t *testing.T) {
+		evaluator := NewSemantics(&gram).
+			RegisterLeaf(param, func(node *ProgramTree, env Env) (Value, error) {
+				return env.GetArg(node.value.(int)), nil
+			}).
+			Evaluator()
+		err := evaluator.Eval(&PGM{Symbol: param, value: 1}, NewEnv(0)).Err()
+		if !IsKind(err, ArgOutOfRange) {
+			t.Errorf("Evaluator.Eval() error = %v, want an error of %v", err, ArgOutOfRange)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Tracer observes the evaluation of every node through Env.Enter and
+// Env.Leave.
+type Tracer interface {
+	Enter(p Path, node *ProgramTree, env Env)
+	Leave(p Path, node *ProgramTree, env Env, result EvalResult)
+}
+
+type tracing struct {
+	tracer Tracer
+	nodes  []*ProgramTree
+	paths  []Path
+}
+
+// WithTracer returns the Env whose evaluations are observed by the tracer.
+func (e Env) WithTracer(t Tracer) Env {
+	e.tracing = &tracing{tracer: t}
+	return e
+}
+
+// Child returns the Env to evaluate the i-th child of the node in, which
+// tells the tracer the path of the child. Without it, the tracer takes the
+// first child of the same pointer, which is wrong for the children sharing
+// a node like in hash-consed trees.
+func (e Env) Child(i int) Env {
+	e.child = i + 1
+	return e
+}
+
+func (e Env) enterTrace(node *ProgramTree) {
+	tr := e.tracing
+	if tr == nil {
+		return
+	}
+	p := Path{}
+	if top := len(tr.nodes) - 1; top >= 0 {
+		p = tr.paths[top]
+		children := tr.nodes[top].Children
+		if e.child > 0 && e.child <= len(children) && children[e.child-1] == node {
+			p = p.Child(e.child - 1)
+		} else {
+			for i, c := range children {
+				if c == node {
+					p = p.Child(i)
+					break
+				}
+			}
+		}
+	}
+	tr.nodes = append(tr.nodes, node)
+	tr.paths = append(tr.paths, p)
+	tr.tracer.Enter(p, node, e)
+}
+
+func (e Env) leaveTrace(node *ProgramTree, result EvalResult) {
+	tr := e.tracing
+	if tr == nil || len(tr.nodes) == 0 {
+		return
+	}
+	top := len(tr.nodes) - 1
+	p := tr.paths[top]
+	tr.nodes, tr.paths = tr.nodes[:top], tr.paths[:top]
+	tr.tracer.Leave(p, node, e, result)
+}
+
+// TraceNode is the evaluation of a node with the arguments of the Env.
+type TraceNode struct {
+	Path     Path
+	Node     *ProgramTree
+	Args     []interface{}
+	Result   EvalResult
+	Children []*TraceNode
+}
+
+// Trace is a Tracer recording the evaluation as a tree.
+type Trace struct {
+	root  *TraceNode
+	stack []*TraceNode
+}
+
+func NewTrace() *Trace {
+	return &Trace{}
+}
+
+func (t *Trace) Enter(p Path, node *ProgramTree, env Env) {
+	args := make([]interface{}, len(env.args))
+	copy(args, env.args)
+	tn := &TraceNode{Path: p, Node: node, Args: args}
+	if len(t.stack) == 0 {
+		t.root = tn
+	} else {
+		top := t.stack[len(t.stack)-1]
+		top.Children = append(top.Children, tn)
+	}
+	t.stack = append(t.stack, tn)
+}
+
+func (t *Trace) Leave(p Path, node *ProgramTree, env Env, result EvalResult) {
+	t.stack[len(t.stack)-1].Result = result
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *Trace) Root() *TraceNode {
+	return t.root
+}
+
+func (tn *TraceNode) label() string {
+	if val, ok := tn.Node.Value(); ok {
+		return fmt.Sprintf("%s(%v)", tn.Node.Symbol, val)
+	}
+	return tn.Node.Symbol.String()
+}
+
+func (tn *TraceNode) outcome() string {
+	if err := tn.Result.Err(); err != nil {
+		return "error: " + err.Error()
+	}
+	if val, ok := tn.Result.Value(); ok {
+		return fmt.Sprint(val)
+	}
+	return "no value"
+}
+
+// String returns the evaluated tree annotated with the results, like
+//
+//	add => 5
+//	   "const"(1) => 1
+//	   "const"(4) => 4
+func (t *Trace) String() string {
+	var sb strings.Builder
+	var write func(tn *TraceNode, depth int)
+	write = func(tn *TraceNode, depth int) {
+		sb.WriteString(strings.Repeat("   ", depth) + tn.label() + " => " + tn.outcome() + "\n")
+		for _, c := range tn.Children {
+			write(c, depth+1)
+		}
+	}
+	if t.root != nil {
+		write(t.root, 0)
+	}
+	return sb.String()
+}
+
+type traceJSON struct {
+	Symbol   string        `json:"symbol"`
+	Path     string        `json:"path"`
+	Value    interface{}   `json:"value,omitempty"`
+	Args     []interface{} `json:"args"`
+	Result   interface{}   `json:"result,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Children []*traceJSON  `json:"children,omitempty"`
+}
+
+func (tn *TraceNode) toJSON() *traceJSON {
+	ret := &traceJSON{
+		Symbol: tn.Node.Symbol.Id,
+		Path:   tn.Path.String(),
+		Value:  tn.Node.value,
+		Args:   tn.Args,
+	}
+	if err := tn.Result.Err(); err != nil {
+		ret.Error = err.Error()
+	} else {
+		ret.Result = tn.Result.value
+	}
+	for _, c := range tn.Children {
+		ret.Children = append(ret.Children, c.toJSON())
+	}
+	return ret
+}
+
+func (t *Trace) MarshalJSON() ([]byte, error) {
+	if t.root == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.root.toJSON())
+}
@@ -0,0 +1,100 @@
+package dsl
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	g := newExpGrammar()
+	evaluator := g.evaluator()
+	// S[exp[add[exp[param(0)], exp[const(4)]]]]
+	pgm := &PGM{Symbol: g.S, Children: []*PGM{
+		g.node(g.plus, g.leaf(g.param, 0), g.leaf(g.cnst, 4)),
+	}}
+
+	wantString := `S => 7
+   exp => 7
+      add => 7
+         exp => 3
+            "param"(0) => 3
+         exp => 4
+            "const"(4) => 4
+`
+	wantJSON := `{"symbol":"S","path":"/","args":[3],"result":7,"children":[` +
+		`{"symbol":"exp","path":"/0","args":[3],"result":7,"children":[` +
+		`{"symbol":"add","path":"/0/0","args":[3],"result":7,"children":[` +
+		`{"symbol":"exp","path":"/0/0/0","args":[3],"result":3,"children":[` +
+		`{"symbol":"param","path":"/0/0/0/0","value":0,"args":[3],"result":3}]},` +
+		`{"symbol":"exp","path":"/0/0/1","args":[3],"result":4,"children":[` +
+		`{"symbol":"const","path":"/0/0/1/0","value":4,"args":[3],"result":4}]}]}]}]}`
+
+	tests := []struct {
+		name string
+		eval func(env Env) EvalResult
+	}{
+		{name: "Evaluator.Eval()", eval: func(env Env) EvalResult { return evaluator.Eval(pgm, env) }},
+		{name: "Program.Run()", eval: func(env Env) EvalResult { return evaluator.Compile(pgm).Run(env) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace := NewTrace()
+			tt.eval(NewEnv(3).WithTracer(trace))
+			if got := trace.String(); got != wantString {
+				t.Errorf("Trace.String() = \n%v, want \n%v", got, wantString)
+			}
+			b, err := json.Marshal(trace)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			if string(b) != wantJSON {
+				t.Errorf("json.Marshal() = %s, want %s", b, wantJSON)
+			}
+		})
+	}
+
+	t.Run("shared child", func(t *testing.T) {
+		// S[exp[add[x, x]]] with x = exp[param(0)] a single node
+		f := NewForest()
+		x := f.Node(g.exp, nil, f.Node(g.param, 0))
+		shared := f.Node(g.S, nil, f.Node(g.exp, nil, f.Node(g.plus, nil, x, x)))
+		want := []string{"/", "/0", "/0/0", "/0/0/0", "/0/0/0/0", "/0/0/1", "/0/0/1/0"}
+		pure := NewSemantics(&g.gram).
+			Register(g.plus, Binary(func(a, b int) int { return a + b })).
+			RegisterLeaf(g.param, Argument).
+			MarkPure().
+			Evaluator()
+		evals := map[string]func(Env) EvalResult{
+			"Evaluator.Eval()": func(env Env) EvalResult { return pure.Eval(shared, env) },
+			"Program.Run()":    func(env Env) EvalResult { return pure.Compile(shared).Run(env) },
+		}
+		for name, eval := range evals {
+			trace := NewTrace()
+			// the cache would answer the second x without tracing it
+			eval(NewEnv(3).WithCache(NewEvalCache(100)).WithTracer(trace))
+			got := make([]string, 0)
+			var walk func(tn *TraceNode)
+			walk = func(tn *TraceNode) {
+				got = append(got, tn.Path.String())
+				for _, c := range tn.Children {
+					walk(c)
+				}
+			}
+			walk(trace.Root())
+			if strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("%s traces %v, want %v", name, got, want)
+			}
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		trace := NewTrace()
+		evaluator.Eval(g.leaf(g.param, 1), NewEnv(3).WithTracer(trace))
+		want := "exp => error: argument out of range: no argument 1 in 1 arguments\n" +
+			`   "param"(1) => error: argument out of range: no argument 1 in 1 arguments` + "\n"
+		if got := trace.String(); got != want {
+			t.Errorf("Trace.String() = \n%v, want \n%v", got, want)
+		}
+	})
+}
@@ -0,0 +1,112 @@
+package dsl
+
+// ValueOf returns the value of the node if it has one of type T.
+func ValueOf[T any](n *ProgramTree) (T, bool) {
+	v, ok := n.value.(T)
+	return v, ok
+}
+
+// Slot gives typed access to the values of the nodes of a terminal symbol,
+// such as the int of a constant.
+type Slot[T any] struct {
+	Symbol *Symbol
+}
+
+func NewSlot[T any](s *Symbol) Slot[T] {
+	return Slot[T]{Symbol: s}
+}
+
+func (s Slot[T]) New(value T) *ProgramTree {
+	return NewProgramTree(s.Symbol).With(value)
+}
+
+// Get returns the value of the node, which is false if the node is not of
+// the symbol or has no value of type T.
+func (s Slot[T]) Get(n *ProgramTree) (T, bool) {
+	if n.Symbol != s.Symbol {
+		var zero T
+		return zero, false
+	}
+	return ValueOf[T](n)
+}
+
+// TypedResult is the typed counterpart of EvalResult.
+type TypedResult[T any] struct {
+	value T
+	ok    bool
+	err   error
+}
+
+func Ok[T any](value T) TypedResult[T] {
+	return TypedResult[T]{value: value, ok: true}
+}
+
+func None[T any]() TypedResult[T] {
+	return TypedResult[T]{}
+}
+
+func Fail[T any](err error) TypedResult[T] {
+	return TypedResult[T]{err: err}
+}
+
+// ResultOf converts an untyped result, which fails with TypeMismatch if its
+// value is not of type T.
+func ResultOf[T any](r EvalResult) TypedResult[T] {
+	if r.err != nil {
+		return Fail[T](r.err)
+	}
+	val, ok := r.Value()
+	if !ok {
+		return None[T]()
+	}
+	v, ok := val.(T)
+	if !ok {
+		return Fail[T](NewEvalError(TypeMismatch, nil, "%v is %T, not %T", val, val, v))
+	}
+	return Ok(v)
+}
+
+func (r TypedResult[T]) Value() (T, bool) {
+	return r.value, r.ok
+}
+
+func (r TypedResult[T]) Err() error {
+	return r.err
+}
+
+func (r TypedResult[T]) Untyped() EvalResult {
+	if r.err != nil {
+		return NewEvalErrorResult(r.err)
+	}
+	if !r.ok {
+		return NewEvalResult(nil)
+	}
+	return NewEvalResult(r.value)
+}
+
+// Arg returns the i-th argument as type T.
+func Arg[T any](env Env, i int) (T, error) {
+	var zero T
+	arg, err := env.Arg(i)
+	if err != nil {
+		return zero, err
+	}
+	v, ok := arg.(T)
+	if !ok {
+		return zero, NewEvalError(TypeMismatch, nil, "argument %d is %T, not %T", i, arg, zero)
+	}
+	return v, nil
+}
+
+// NewTypedEvaluator wraps a typed evaluation function as an Evaluator so
+// that it can be used by the synthesizer.
+func NewTypedEvaluator[T any](eval func(*ProgramTree, Env) TypedResult[T]) Evaluator {
+	return NewEvaluator(func(n *ProgramTree, env Env) EvalResult {
+		return eval(n, env).Untyped()
+	})
+}
+
+// EvalAs evaluates the tree and converts the result to type T.
+func EvalAs[T any](e *Evaluator, n *ProgramTree, env Env) TypedResult[T] {
+	return ResultOf[T](e.Eval(n, env))
+}
@@ -0,0 +1,120 @@
+package dsl
+
+import "testing"
+
+func TestSlot(t *testing.T) {
+	cnst := NewSymbol("const")
+	name := NewSymbol("name")
+	ints := NewSlot[int](cnst)
+
+	tests := []struct {
+		name   string
+		node   *PGM
+		want   int
+		wantOk bool
+	}{
+		{name: "typed value", node: ints.New(3), want: 3, wantOk: true},
+		{name: "untyped value", node: NewProgramTree(cnst).With(4), want: 4, wantOk: true},
+		{name: "other type", node: NewProgramTree(cnst).With("4"), wantOk: false},
+		{name: "no value", node: NewProgramTree(cnst), wantOk: false},
+		{name: "other symbol", node: NewProgramTree(name).With(4), wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ints.Get(tt.node)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("Slot.Get() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestTypedResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		result EvalResult
+		want   int
+		wantOk bool
+	}{
+		{name: "int", result: Ok(5).Untyped(), want: 5, wantOk: true},
+		{name: "none", result: None[int]().Untyped(), wantOk: false},
+		{name: "other type", result: NewEvalResult("5"), wantOk: false},
+		{name: "error", result: NewEvalErrorResult(NewEvalError(Failure, nil, "boom")), wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ResultOf[int](tt.result).Value()
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("ResultOf().Value() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestArg(t *testing.T) {
+	env := NewEnv(1, "a")
+
+	tests := []struct {
+		name     string
+		index    int
+		want     int
+		wantKind ErrorKind
+		wantErr  bool
+	}{
+		{name: "int", index: 0, want: 1},
+		{name: "other type", index: 1, wantKind: TypeMismatch, wantErr: true},
+		{name: "out of range", index: 2, wantKind: ArgOutOfRange, wantErr: true},
+		{name: "negative", index: -1, wantKind: ArgOutOfRange, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Arg[int](env, tt.index)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Arg() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !IsKind(err, tt.wantKind) {
+				t.Errorf("Arg() error = %v, want %v", err, tt.wantKind)
+			}
+			if got != tt.want {
+				t.Errorf("Arg() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTypedEvaluator(t *testing.T) {
+	plus := NewSymbol("add")
+	cnst := NewSymbol("const")
+	ints := NewSlot[int](cnst)
+
+	var eval func(*PGM, Env) TypedResult[int]
+	eval = func(n *PGM, env Env) TypedResult[int] {
+		if n.Symbol == cnst {
+			v, ok := ints.Get(n)
+			if !ok {
+				return None[int]()
+			}
+			return Ok(v)
+		}
+		sum := 0
+		for _, c := range n.Children {
+			v, ok := eval(c, env).Value()
+			if !ok {
+				return None[int]()
+			}
+			sum += v
+		}
+		return Ok(sum)
+	}
+	evaluator := NewTypedEvaluator(eval)
+
+	tree := NewProgramTree(plus)
+	tree.AddChildren(ints.New(1), ints.New(4))
+	if got, ok := EvalAs[int](&evaluator, tree, NewEnv()).Value(); !ok || got != 5 {
+		t.Errorf("EvalAs() = %v, %v, want %v, %v", got, ok, 5, true)
+	}
+	tree.AddChildren(NewProgramTree(cnst))
+	if _, ok := evaluator.Eval(tree, NewEnv()).Value(); ok {
+		t.Errorf("Evaluator.Eval() has a value for a tree with a hole")
+	}
+}
@@ -0,0 +1,160 @@
+package dsl
+
+type Action int
+
+const (
+	Continue Action = iota
+	SkipChildren
+	Abort
+)
+
+type Visitor interface {
+	Enter(p Path, n *ProgramTree) Action
+	Leave(p Path, n *ProgramTree) Action
+}
+
+// VisitorFuncs is a Visitor made of optional functions; a nil function
+// continues the walk.
+type VisitorFuncs struct {
+	EnterFunc func(Path, *ProgramTree) Action
+	LeaveFunc func(Path, *ProgramTree) Action
+}
+
+func (v VisitorFuncs) Enter(p Path, n *ProgramTree) Action {
+	if v.EnterFunc == nil {
+		return Continue
+	}
+	return v.EnterFunc(p, n)
+}
+
+func (v VisitorFuncs) Leave(p Path, n *ProgramTree) Action {
+	if v.LeaveFunc == nil {
+		return Continue
+	}
+	return v.LeaveFunc(p, n)
+}
+
+// Walk visits the tree depth-first and reports whether it was not aborted.
+// Leave is not called for nodes whose Enter returns SkipChildren. The paths
+// given to the visitor are reused for the next nodes and must be cloned to
+// be kept.
+func Walk(v Visitor, root *ProgramTree) bool {
+	return walk(v, &pathBuffer{path: Path{}}, root)
+}
+
+func walk(v Visitor, buf *pathBuffer, n *ProgramTree) bool {
+	switch v.Enter(buf.get(), n) {
+	case Abort:
+		return false
+	case SkipChildren:
+		return true
+	}
+	for i, c := range n.Children {
+		buf.push(i)
+		ok := walk(v, buf, c)
+		buf.pop()
+		if !ok {
+			return false
+		}
+	}
+	return v.Leave(buf.get(), n) != Abort
+}
+
+type Transformer interface {
+	Transform(p Path, n *ProgramTree) (*ProgramTree, Action)
+}
+
+type TransformFunc func(Path, *ProgramTree) (*ProgramTree, Action)
+
+func (f TransformFunc) Transform(p Path, n *ProgramTree) (*ProgramTree, Action) {
+	return f(p, n)
+}
+
+// TransformTopDown rewrites each node before its children, then descends
+// into the children of the replacement unless SkipChildren is returned. A
+// nil replacement keeps the node. The input is left untouched, while the
+// result shares the skipped subtrees with the input. On Abort it returns
+// the input root and false. The paths given to the transformer are reused
+// for the next nodes like the ones of Walk.
+func TransformTopDown(root *ProgramTree, t Transformer) (*ProgramTree, bool) {
+	ret, ok := transformTopDown(t, &pathBuffer{path: Path{}}, root)
+	if !ok {
+		return root, false
+	}
+	return ret, true
+}
+
+func transformTopDown(t Transformer, buf *pathBuffer, n *ProgramTree) (*ProgramTree, bool) {
+	repl, action := t.Transform(buf.get(), n)
+	if repl == nil {
+		repl = n
+	}
+	switch action {
+	case Abort:
+		return nil, false
+	case SkipChildren:
+		return repl, true
+	}
+	ret := NewProgramTree(repl.Symbol).With(repl.value)
+	for i, c := range repl.Children {
+		buf.push(i)
+		child, ok := transformTopDown(t, buf, c)
+		buf.pop()
+		if !ok {
+			return nil, false
+		}
+		ret.AddChildren(child)
+	}
+	return ret, true
+}
+
+// TransformBottomUp rewrites each node after its children. The transformer
+// receives a fresh copy of the node holding the rewritten children, which it
+// may modify or replace. On Abort it returns the input root and false. The
+// paths given to the transformer are reused like the ones of Walk.
+func TransformBottomUp(root *ProgramTree, t Transformer) (*ProgramTree, bool) {
+	ret, ok := transformBottomUp(t, &pathBuffer{path: Path{}}, root)
+	if !ok {
+		return root, false
+	}
+	return ret, true
+}
+
+func transformBottomUp(t Transformer, buf *pathBuffer, n *ProgramTree) (*ProgramTree, bool) {
+	cpy := NewProgramTree(n.Symbol).With(n.value)
+	for i, c := range n.Children {
+		buf.push(i)
+		child, ok := transformBottomUp(t, buf, c)
+		buf.pop()
+		if !ok {
+			return nil, false
+		}
+		cpy.AddChildren(child)
+	}
+	repl, action := t.Transform(buf.get(), cpy)
+	if action == Abort {
+		return nil, false
+	}
+	if repl == nil {
+		repl = cpy
+	}
+	return repl, true
+}
+
+// Fold combines the results of the children into the result of each node.
+func Fold[T any](n *ProgramTree, f func(n *ProgramTree, children []T) T) T {
+	results := make([]T, len(n.Children))
+	for i, c := range n.Children {
+		results[i] = Fold(c, f)
+	}
+	return f(n, results)
+}
+
+// Map rebuilds the tree bottom-up with f applied to a fresh copy of each
+// node holding the mapped children.
+func Map(n *ProgramTree, f func(*ProgramTree) *ProgramTree) *ProgramTree {
+	ret, _ := TransformBottomUp(n, TransformFunc(func(_ Path, c *ProgramTree) (*ProgramTree, Action) {
+		return f(c), Continue
+	}))
+	return ret
+}
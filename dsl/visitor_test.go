@@ -0,0 +1,175 @@
+package dsl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	plus := NewSymbol("add")
+	mult := NewSymbol("mult")
+	cnst := NewSymbol("const")
+
+	tests := []struct {
+		name     string
+		enter    func(Path, *PGM) Action
+		want     []string
+		wantDone bool
+	}{
+		{
+			name:     "all nodes",
+			want:     []string{"+mult", "+add", "+const", "-const", "+const", "-const", "-add", "+const", "-const", "-mult"},
+			wantDone: true,
+		},
+		{
+			name: "skip children",
+			enter: func(p Path, n *PGM) Action {
+				if n.Symbol == plus {
+					return SkipChildren
+				}
+				return Continue
+			},
+			want:     []string{"+mult", "+add", "+const", "-const", "-mult"},
+			wantDone: true,
+		},
+		{
+			name: "abort",
+			enter: func(p Path, n *PGM) Action {
+				if len(p) == 2 {
+					return Abort
+				}
+				return Continue
+			},
+			want:     []string{"+mult", "+add", "+const"},
+			wantDone: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0)
+			v := VisitorFuncs{
+				EnterFunc: func(p Path, n *PGM) Action {
+					got = append(got, "+"+n.Symbol.Id)
+					if tt.enter != nil {
+						return tt.enter(p, n)
+					}
+					return Continue
+				},
+				LeaveFunc: func(p Path, n *PGM) Action {
+					got = append(got, "-"+n.Symbol.Id)
+					return Continue
+				},
+			}
+			done := Walk(v, newPathTestTree(plus, mult, cnst))
+			if done != tt.wantDone {
+				t.Errorf("Walk() = %v, want %v", done, tt.wantDone)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Walk() visits %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransform(t *testing.T) {
+	plus := NewSymbol("add")
+	mult := NewSymbol("mult")
+	cnst := NewSymbol("const")
+
+	// replaces add[const(a),const(b)] with const(a+b)
+	foldPlus := TransformFunc(func(p Path, n *PGM) (*PGM, Action) {
+		if n.Symbol != plus {
+			return n, Continue
+		}
+		sum := 0
+		for _, c := range n.Children {
+			v, ok := c.Value()
+			if !ok {
+				return n, Continue
+			}
+			sum += v.(int)
+		}
+		return NewProgramTree(cnst).With(sum), SkipChildren
+	})
+
+	tests := []struct {
+		name     string
+		run      func(*PGM) (*PGM, bool)
+		want     string
+		wantDone bool
+	}{
+		{
+			name: "top-down",
+			run: func(tree *PGM) (*PGM, bool) {
+				return TransformTopDown(tree, foldPlus)
+			},
+			want:     `"mult"["const"(5),"const"(3)]`,
+			wantDone: true,
+		},
+		{
+			name: "bottom-up",
+			run: func(tree *PGM) (*PGM, bool) {
+				return TransformBottomUp(tree, foldPlus)
+			},
+			want:     `"mult"["const"(5),"const"(3)]`,
+			wantDone: true,
+		},
+		{
+			name: "abort",
+			run: func(tree *PGM) (*PGM, bool) {
+				return TransformBottomUp(tree, TransformFunc(func(p Path, n *PGM) (*PGM, Action) {
+					if n.Symbol == plus {
+						return nil, Abort
+					}
+					return NewProgramTree(cnst).With(0), Continue
+				}))
+			},
+			want:     `"mult"["add"["const"(1),"const"(4)],"const"(3)]`,
+			wantDone: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newPathTestTree(plus, mult, cnst)
+			before := tree.String()
+			got, done := tt.run(tree)
+			if done != tt.wantDone {
+				t.Errorf("transform done = %v, want %v", done, tt.wantDone)
+			}
+			if got.String() != tt.want {
+				t.Errorf("transform = %v, want %v", got, tt.want)
+			}
+			if tree.String() != before {
+				t.Errorf("transform modified the input to %v", tree)
+			}
+		})
+	}
+}
+
+func TestFoldAndMap(t *testing.T) {
+	plus := NewSymbol("add")
+	mult := NewSymbol("mult")
+	cnst := NewSymbol("const")
+	tree := newPathTestTree(plus, mult, cnst)
+
+	size := Fold(tree, func(n *PGM, children []int) int {
+		sum := 1
+		for _, c := range children {
+			sum += c
+		}
+		return sum
+	})
+	if size != 5 {
+		t.Errorf("Fold() = %d, want %d", size, 5)
+	}
+
+	doubled := Map(tree, func(n *PGM) *PGM {
+		if v, ok := n.Value(); ok {
+			n.With(v.(int) * 2)
+		}
+		return n
+	})
+	if want := `"mult"["add"["const"(2),"const"(8)],"const"(6)]`; doubled.String() != want {
+		t.Errorf("Map() = %v, want %v", doubled, want)
+	}
+}
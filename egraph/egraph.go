@@ -0,0 +1,496 @@
+package egraph
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+	"github.com/KeitaTakenouchi/grammars/rewrite"
+)
+
+type ClassID int
+
+// ENode is a symbol applied to equivalence classes instead of subtrees.
+type ENode struct {
+	Symbol   *dsl.Symbol
+	Value    interface{}
+	Children []ClassID
+}
+
+func (n *ENode) String() string {
+	str := n.Symbol.String()
+	if n.Value != nil {
+		str += fmt.Sprintf("(%v)", n.Value)
+	}
+	if len(n.Children) == 0 {
+		return str
+	}
+	ids := make([]string, len(n.Children))
+	for i, c := range n.Children {
+		ids[i] = fmt.Sprintf("#%d", c)
+	}
+	return str + "[" + strings.Join(ids, ",") + "]"
+}
+
+// nodeKey identifies the nodes equal up to the equality of their values.
+type nodeKey struct {
+	symbol *dsl.Symbol
+	// value is the value itself if comparable, or its formatted string
+	value interface{}
+	// children is the class ids of the children, 8 bytes each
+	children string
+}
+
+func (n *ENode) key() nodeKey {
+	k := nodeKey{symbol: n.Symbol, value: n.Value}
+	if n.Value != nil && !reflect.ValueOf(n.Value).Comparable() {
+		k.value = fmt.Sprintf("%T|%#v", n.Value, n.Value)
+	}
+	if len(n.Children) > 0 {
+		buf := make([]byte, 0, 8*len(n.Children))
+		for _, c := range n.Children {
+			buf = binary.LittleEndian.AppendUint64(buf, uint64(c))
+		}
+		k.children = string(buf)
+	}
+	return k
+}
+
+type parentRef struct {
+	node  *ENode
+	class ClassID
+}
+
+type eclass struct {
+	nodes   []*ENode
+	parents []parentRef
+}
+
+// EGraph keeps equivalence classes of terms closed under congruence: if
+// the children of two nodes are equivalent, so are the nodes.
+type EGraph struct {
+	parent  []ClassID
+	classes map[ClassID]*eclass
+	memo    map[nodeKey]ClassID
+	pending []ClassID
+}
+
+func New() *EGraph {
+	return &EGraph{
+		classes: make(map[ClassID]*eclass),
+		memo:    make(map[nodeKey]ClassID),
+	}
+}
+
+func (g *EGraph) Find(id ClassID) ClassID {
+	root := id
+	for g.parent[root] != root {
+		root = g.parent[root]
+	}
+	for g.parent[id] != root {
+		g.parent[id], id = root, g.parent[id]
+	}
+	return root
+}
+
+func (g *EGraph) canonicalize(n *ENode) {
+	for i, c := range n.Children {
+		n.Children[i] = g.Find(c)
+	}
+}
+
+func (g *EGraph) Add(s *dsl.Symbol, value interface{}, children ...ClassID) ClassID {
+	n := &ENode{
+		Symbol:   s,
+		Value:    value,
+		Children: make([]ClassID, len(children)),
+	}
+	copy(n.Children, children)
+	g.canonicalize(n)
+	k := n.key()
+	if id, ok := g.memo[k]; ok {
+		return g.Find(id)
+	}
+	id := ClassID(len(g.parent))
+	g.parent = append(g.parent, id)
+	g.classes[id] = &eclass{nodes: []*ENode{n}}
+	for _, c := range n.Children {
+		g.classes[c].parents = append(g.classes[c].parents, parentRef{n, id})
+	}
+	g.memo[k] = id
+	return id
+}
+
+func (g *EGraph) AddTree(t *dsl.ProgramTree) ClassID {
+	children := make([]ClassID, len(t.Children))
+	for i, c := range t.Children {
+		children[i] = g.AddTree(c)
+	}
+	val, _ := t.Value()
+	return g.Add(t.Symbol, val, children...)
+}
+
+// Lookup returns the class of the tree without adding it.
+func (g *EGraph) Lookup(t *dsl.ProgramTree) (ClassID, bool) {
+	n := &ENode{Symbol: t.Symbol, Children: make([]ClassID, len(t.Children))}
+	n.Value, _ = t.Value()
+	for i, c := range t.Children {
+		id, ok := g.Lookup(c)
+		if !ok {
+			return 0, false
+		}
+		n.Children[i] = id
+	}
+	id, ok := g.memo[n.key()]
+	if !ok {
+		return 0, false
+	}
+	return g.Find(id), true
+}
+
+// Union merges two classes and reports whether they were distinct. The
+// congruence closure is restored by Rebuild.
+func (g *EGraph) Union(a, b ClassID) bool {
+	a, b = g.Find(a), g.Find(b)
+	if a == b {
+		return false
+	}
+	ca, cb := g.classes[a], g.classes[b]
+	if len(ca.parents) < len(cb.parents) {
+		a, b = b, a
+		ca, cb = cb, ca
+	}
+	g.parent[b] = a
+	ca.nodes = append(ca.nodes, cb.nodes...)
+	ca.parents = append(ca.parents, cb.parents...)
+	delete(g.classes, b)
+	g.pending = append(g.pending, a)
+	return true
+}
+
+func (g *EGraph) Equivalent(a, b ClassID) bool {
+	return g.Find(a) == g.Find(b)
+}
+
+func (g *EGraph) Rebuild() {
+	for len(g.pending) > 0 {
+		todo := g.pending
+		g.pending = nil
+		done := make(map[ClassID]struct{})
+		for _, id := range todo {
+			id = g.Find(id)
+			if _, ok := done[id]; ok {
+				continue
+			}
+			done[id] = struct{}{}
+			g.repair(id)
+		}
+	}
+	for _, cls := range g.classes {
+		unique := make(map[nodeKey]struct{})
+		nodes := cls.nodes[:0]
+		for _, n := range cls.nodes {
+			g.canonicalize(n)
+			k := n.key()
+			if _, ok := unique[k]; ok {
+				continue
+			}
+			unique[k] = struct{}{}
+			nodes = append(nodes, n)
+		}
+		cls.nodes = nodes
+	}
+}
+
+func (g *EGraph) repair(id ClassID) {
+	cls := g.classes[id]
+	parents := cls.parents
+	cls.parents = nil
+	for _, p := range parents {
+		delete(g.memo, p.node.key())
+		g.canonicalize(p.node)
+		g.memo[p.node.key()] = g.Find(p.class)
+	}
+	unique := make(map[nodeKey]parentRef)
+	for _, p := range parents {
+		k := p.node.key()
+		if q, ok := unique[k]; ok {
+			g.Union(p.class, q.class)
+		}
+		unique[k] = parentRef{p.node, g.Find(p.class)}
+	}
+	owner := g.classes[g.Find(id)]
+	for _, p := range unique {
+		owner.parents = append(owner.parents, p)
+	}
+}
+
+func (g *EGraph) Classes() []ClassID {
+	ret := make([]ClassID, 0, len(g.classes))
+	for id := range g.classes {
+		ret = append(ret, id)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+func (g *EGraph) Nodes(id ClassID) []*ENode {
+	return g.classes[g.Find(id)].nodes
+}
+
+func (g *EGraph) NodeCount() int {
+	count := 0
+	for _, cls := range g.classes {
+		count += len(cls.nodes)
+	}
+	return count
+}
+
+type subst struct {
+	trees  map[string]ClassID
+	values map[string]interface{}
+}
+
+func (s subst) clone() subst {
+	ret := subst{
+		trees:  make(map[string]ClassID, len(s.trees)),
+		values: make(map[string]interface{}, len(s.values)),
+	}
+	for k, v := range s.trees {
+		ret.trees[k] = v
+	}
+	for k, v := range s.values {
+		ret.values[k] = v
+	}
+	return ret
+}
+
+func (g *EGraph) ematch(p *rewrite.Pattern, id ClassID, s subst) []subst {
+	id = g.Find(id)
+	if p.IsVar() {
+		if bound, ok := s.trees[p.Var]; ok {
+			if g.Find(bound) != id {
+				return nil
+			}
+			return []subst{s}
+		}
+		s = s.clone()
+		s.trees[p.Var] = id
+		return []subst{s}
+	}
+	ret := make([]subst, 0)
+	for _, n := range g.classes[id].nodes {
+		if n.Symbol != p.Symbol || len(n.Children) != len(p.Children) {
+			continue
+		}
+		if p.Value != nil && !dsl.EqualValue(p.Value, n.Value) {
+			continue
+		}
+		cur := s
+		if p.ValueVar != "" {
+			if n.Value == nil {
+				continue
+			}
+			if bound, ok := s.values[p.ValueVar]; ok {
+				if !dsl.EqualValue(bound, n.Value) {
+					continue
+				}
+			} else {
+				cur = s.clone()
+				cur.values[p.ValueVar] = n.Value
+			}
+		}
+		substs := []subst{cur}
+		for i, c := range p.Children {
+			next := make([]subst, 0)
+			for _, sub := range substs {
+				next = append(next, g.ematch(c, n.Children[i], sub)...)
+			}
+			substs = next
+		}
+		ret = append(ret, substs...)
+	}
+	return ret
+}
+
+func (g *EGraph) addPattern(p *rewrite.Pattern, s subst) ClassID {
+	if p.IsVar() {
+		return s.trees[p.Var]
+	}
+	children := make([]ClassID, len(p.Children))
+	for i, c := range p.Children {
+		children[i] = g.addPattern(c, s)
+	}
+	val := p.Value
+	if p.ValueVar != "" {
+		val = s.values[p.ValueVar]
+	}
+	return g.Add(p.Symbol, val, children...)
+}
+
+type Limits struct {
+	MaxIterations int
+	MaxNodes      int
+	Timeout       time.Duration
+}
+
+type StopReason int
+
+const (
+	Saturated StopReason = iota
+	IterationLimit
+	NodeLimit
+	TimeLimit
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case Saturated:
+		return "saturated"
+	case IterationLimit:
+		return "iteration limit"
+	case NodeLimit:
+		return "node limit"
+	case TimeLimit:
+		return "time limit"
+	}
+	return fmt.Sprintf("StopReason(%d)", int(r))
+}
+
+type Report struct {
+	Iterations int
+	Stop       StopReason
+	Nodes      int
+	Classes    int
+}
+
+// Saturate applies the rules until no rule adds new equalities or one of
+// the limits is hit. A zero limit is unbounded. The number of nodes is
+// checked while the matches are applied, so that an iteration doesn't grow
+// the graph far beyond it.
+func (g *EGraph) Saturate(rules []rewrite.Rule, limits Limits) Report {
+	start := time.Now()
+	report := Report{Stop: Saturated}
+	for {
+		if limits.MaxIterations > 0 && report.Iterations >= limits.MaxIterations {
+			report.Stop = IterationLimit
+			break
+		}
+		if limits.Timeout > 0 && time.Since(start) >= limits.Timeout {
+			report.Stop = TimeLimit
+			break
+		}
+		report.Iterations++
+
+		type match struct {
+			rule  rewrite.Rule
+			class ClassID
+			subst subst
+		}
+		matches := make([]match, 0)
+		for _, rule := range rules {
+			for _, id := range g.Classes() {
+				for _, s := range g.ematch(rule.Lhs, id, subst{}) {
+					matches = append(matches, match{rule, id, s})
+				}
+			}
+		}
+
+		// every node added makes a class, and only Rebuild removes nodes
+		nodes, added := g.NodeCount(), len(g.parent)
+		full := false
+		changed := false
+		for _, m := range matches {
+			id := g.addPattern(m.rule.Rhs, m.subst)
+			if g.Union(m.class, id) {
+				changed = true
+			}
+			if limits.MaxNodes > 0 && nodes+len(g.parent)-added >= limits.MaxNodes {
+				full = true
+				break
+			}
+		}
+		g.Rebuild()
+
+		if full {
+			report.Stop = NodeLimit
+			break
+		}
+		if !changed {
+			break
+		}
+		if limits.MaxNodes > 0 && g.NodeCount() >= limits.MaxNodes {
+			report.Stop = NodeLimit
+			break
+		}
+	}
+	report.Nodes = g.NodeCount()
+	report.Classes = len(g.classes)
+	return report
+}
+
+// CostFunc computes the cost of a node from the best costs of its children.
+// The cost must be monotonic and greater than the cost of every child.
+type CostFunc func(n *ENode, childCosts []float64) float64
+
+func AstSize(n *ENode, childCosts []float64) float64 {
+	cost := 1.0
+	for _, c := range childCosts {
+		cost += c
+	}
+	return cost
+}
+
+// Extract returns the cheapest tree of the class and its cost.
+func (g *EGraph) Extract(id ClassID, cost CostFunc) (*dsl.ProgramTree, float64) {
+	type best struct {
+		cost float64
+		node *ENode
+	}
+	bests := make(map[ClassID]best)
+	for changed := true; changed; {
+		changed = false
+		for _, cid := range g.Classes() {
+			for _, n := range g.classes[cid].nodes {
+				childCosts := make([]float64, len(n.Children))
+				complete := true
+				for i, c := range n.Children {
+					b, ok := bests[g.Find(c)]
+					if !ok {
+						complete = false
+						break
+					}
+					childCosts[i] = b.cost
+				}
+				if !complete {
+					continue
+				}
+				c := cost(n, childCosts)
+				if b, ok := bests[cid]; !ok || c < b.cost {
+					bests[cid] = best{c, n}
+					changed = true
+				}
+			}
+		}
+	}
+
+	var build func(ClassID) *dsl.ProgramTree
+	build = func(cid ClassID) *dsl.ProgramTree {
+		n := bests[g.Find(cid)].node
+		t := dsl.NewProgramTree(n.Symbol).With(n.Value)
+		for _, c := range n.Children {
+			t.AddChildren(build(c))
+		}
+		return t
+	}
+	b, ok := bests[g.Find(id)]
+	if !ok {
+		return nil, math.Inf(1)
+	}
+	return build(id), b.cost
+}
@@ -0,0 +1,268 @@
+package egraph
+
+import (
+	"testing"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+	"github.com/KeitaTakenouchi/grammars/rewrite"
+)
+
+func mustParseTree(t *testing.T, g *dsl.Grammar, src string) *dsl.ProgramTree {
+	t.Helper()
+	tree, err := rewrite.ParseTree(g, src)
+	if err != nil {
+		t.Fatalf("ParseTree(%q) error = %v", src, err)
+	}
+	return tree
+}
+
+func mustParseRules(t *testing.T, g *dsl.Grammar, src string) []rewrite.Rule {
+	t.Helper()
+	rules, err := rewrite.ParseRules(g, src)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	return rules
+}
+
+func TestEGraph_Congruence(t *testing.T) {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	plus := dsl.NewSymbol("add")
+	minus := dsl.NewSymbol("minus")
+	mult := dsl.NewSymbol("mult")
+	cnst := dsl.NewSymbol("const")
+	param := dsl.NewSymbol("param")
+
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, exp)
+	gram.AddRule(exp, plus)
+	gram.AddRule(exp, minus)
+	gram.AddRule(exp, mult)
+	gram.AddRule(exp, cnst)
+	gram.AddRule(exp, param)
+	gram.AddRule(plus, exp, exp)
+	gram.AddRule(minus, exp, exp)
+	gram.AddRule(mult, exp, exp)
+
+	g := New()
+
+	a := g.AddTree(mustParseTree(t, &gram, "exp(param(0))"))
+	b := g.AddTree(mustParseTree(t, &gram, "exp(param(1))"))
+	fa := g.AddTree(mustParseTree(t, &gram, "add(exp(param(0)), exp(param(0)))"))
+	fb := g.AddTree(mustParseTree(t, &gram, "add(exp(param(1)), exp(param(1)))"))
+	if g.Equivalent(fa, fb) {
+		t.Fatalf("EGraph.Equivalent() = true before the union")
+	}
+	if again := g.AddTree(mustParseTree(t, &gram, "exp(param(0))")); again != a {
+		t.Errorf("EGraph.AddTree() = %d, want the existing class %d", again, a)
+	}
+
+	if !g.Union(a, b) {
+		t.Errorf("EGraph.Union() = false for distinct classes")
+	}
+	if g.Union(b, a) {
+		t.Errorf("EGraph.Union() = true for the same class")
+	}
+	g.Rebuild()
+	if !g.Equivalent(fa, fb) {
+		t.Errorf("EGraph.Equivalent() = false for congruent nodes")
+	}
+	if got := len(g.Nodes(fa)); got != 1 {
+		t.Errorf("EGraph.Nodes() has %d nodes, want the congruent nodes merged into 1", got)
+	}
+}
+
+func TestEGraph_Saturate(t *testing.T) {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	plus := dsl.NewSymbol("add")
+	minus := dsl.NewSymbol("minus")
+	mult := dsl.NewSymbol("mult")
+	cnst := dsl.NewSymbol("const")
+	param := dsl.NewSymbol("param")
+
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, exp)
+	gram.AddRule(exp, plus)
+	gram.AddRule(exp, minus)
+	gram.AddRule(exp, mult)
+	gram.AddRule(exp, cnst)
+	gram.AddRule(exp, param)
+	gram.AddRule(plus, exp, exp)
+	gram.AddRule(minus, exp, exp)
+	gram.AddRule(mult, exp, exp)
+
+	rules := mustParseRules(t, &gram, `
+		exp(add(?x, exp(const(0)))) => ?x
+		exp(mult(?x, exp(const(1)))) => ?x
+		exp(minus(?x, ?x)) => exp(const(0))
+		add(?x, ?y) => add(?y, ?x)
+		mult(?x, ?y) => mult(?y, ?x)
+	`)
+
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "identities",
+			src:  "S(exp(mult(exp(add(exp(const(0)), exp(param(1)))), exp(const(1)))))",
+			want: "S(exp(param(1)))",
+		},
+		{
+			name: "cancellation",
+			src:  "S(exp(add(exp(minus(exp(param(0)), exp(param(0)))), exp(param(2)))))",
+			want: "S(exp(param(2)))",
+		},
+		{
+			name: "nothing to simplify",
+			src:  "S(exp(add(exp(param(0)), exp(param(1)))))",
+			want: "S(exp(add(exp(param(0)), exp(param(1)))))",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New()
+			root := g.AddTree(mustParseTree(t, &gram, tt.src))
+			report := g.Saturate(rules, Limits{MaxIterations: 20})
+			if report.Stop != Saturated {
+				t.Errorf("EGraph.Saturate() stops by %v, want %v", report.Stop, Saturated)
+			}
+			got, cost := g.Extract(root, AstSize)
+			want := mustParseTree(t, &gram, tt.want)
+			if got.String() != want.String() {
+				t.Errorf("EGraph.Extract() = %v, want %v", got, want)
+			}
+			if wantCost := float64(len(want.Leaves()) + countInner(want)); cost != wantCost {
+				t.Errorf("EGraph.Extract() cost = %v, want %v", cost, wantCost)
+			}
+		})
+	}
+}
+
+func countInner(t *dsl.ProgramTree) int {
+	if len(t.Children) == 0 {
+		return 0
+	}
+	count := 1
+	for _, c := range t.Children {
+		count += countInner(c)
+	}
+	return count
+}
+
+func TestEGraph_Limits(t *testing.T) {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	plus := dsl.NewSymbol("add")
+	minus := dsl.NewSymbol("minus")
+	mult := dsl.NewSymbol("mult")
+	cnst := dsl.NewSymbol("const")
+	param := dsl.NewSymbol("param")
+
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, exp)
+	gram.AddRule(exp, plus)
+	gram.AddRule(exp, minus)
+	gram.AddRule(exp, mult)
+	gram.AddRule(exp, cnst)
+	gram.AddRule(exp, param)
+	gram.AddRule(plus, exp, exp)
+	gram.AddRule(minus, exp, exp)
+	gram.AddRule(mult, exp, exp)
+
+	// associativity and commutativity grow the graph quickly
+	rules := mustParseRules(t, &gram, `
+		add(?x, ?y) => add(?y, ?x)
+		add(exp(add(?x, ?y)), ?z) => add(?x, exp(add(?y, ?z)))
+		add(?x, exp(add(?y, ?z))) => add(exp(add(?x, ?y)), ?z)
+	`)
+	src := "add(exp(add(exp(add(exp(param(0)), exp(param(1)))), exp(param(2)))), exp(add(exp(param(3)), exp(param(4)))))"
+
+	tests := []struct {
+		name   string
+		limits Limits
+		want   StopReason
+	}{
+		{name: "iterations", limits: Limits{MaxIterations: 1}, want: IterationLimit},
+		{name: "nodes", limits: Limits{MaxNodes: 30}, want: NodeLimit},
+		{name: "nodes in an iteration", limits: Limits{MaxNodes: 22}, want: NodeLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New()
+			g.AddTree(mustParseTree(t, &gram, src))
+			got := g.Saturate(rules, tt.limits)
+			if got.Stop != tt.want {
+				t.Errorf("EGraph.Saturate() stops by %v, want %v", got.Stop, tt.want)
+			}
+			// the right sides add at most three nodes past the limit
+			if tt.limits.MaxNodes > 0 && got.Nodes > tt.limits.MaxNodes+3 {
+				t.Errorf("EGraph.Saturate() grows to %d nodes, want at most %d", got.Nodes, tt.limits.MaxNodes+3)
+			}
+		})
+	}
+}
+
+func TestEGraph_Lookup(t *testing.T) {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	plus := dsl.NewSymbol("add")
+	minus := dsl.NewSymbol("minus")
+	mult := dsl.NewSymbol("mult")
+	cnst := dsl.NewSymbol("const")
+	param := dsl.NewSymbol("param")
+
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, exp)
+	gram.AddRule(exp, plus)
+	gram.AddRule(exp, minus)
+	gram.AddRule(exp, mult)
+	gram.AddRule(exp, cnst)
+	gram.AddRule(exp, param)
+	gram.AddRule(plus, exp, exp)
+	gram.AddRule(minus, exp, exp)
+	gram.AddRule(mult, exp, exp)
+
+	rules := mustParseRules(t, &gram, `
+		add(?x, ?y) => add(?y, ?x)
+	`)
+	g := New()
+	seen := g.AddTree(mustParseTree(t, &gram, "add(exp(param(0)), exp(const(1)))"))
+	g.Saturate(rules, Limits{MaxIterations: 10})
+
+	id, ok := g.Lookup(mustParseTree(t, &gram, "add(exp(const(1)), exp(param(0)))"))
+	if !ok || !g.Equivalent(id, seen) {
+		t.Errorf("EGraph.Lookup() does not find the equivalent program")
+	}
+	if _, ok := g.Lookup(mustParseTree(t, &gram, "add(exp(const(2)), exp(param(0)))")); ok {
+		t.Errorf("EGraph.Lookup() finds a program never added")
+	}
+}
+
+func TestEGraph_Add_Values(t *testing.T) {
+	list := dsl.NewSymbol("list")
+	cnst := dsl.NewSymbol("const")
+	tests := []struct {
+		name     string
+		a, b     interface{}
+		wantSame bool
+	}{
+		{name: "equal ints", a: 1, b: 1, wantSame: true},
+		{name: "different types", a: 1, b: "1", wantSame: false},
+		{name: "equal slices", a: []int{1, 2}, b: []int{1, 2}, wantSame: true},
+		{name: "different slices", a: []int{1, 2}, b: []int{2, 1}, wantSame: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New()
+			a := g.Add(list, nil, g.Add(cnst, tt.a))
+			b := g.Add(list, nil, g.Add(cnst, tt.b))
+			if got := a == b; got != tt.wantSame {
+				t.Errorf("EGraph.Add() gives the same class = %v, want %v", got, tt.wantSame)
+			}
+		})
+	}
+}
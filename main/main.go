@@ -1,16 +1,32 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/KeitaTakenouchi/grammars/absint"
+	"github.com/KeitaTakenouchi/grammars/debugger"
 	"github.com/KeitaTakenouchi/grammars/dsl"
+	"github.com/KeitaTakenouchi/grammars/rewrite"
 	"github.com/KeitaTakenouchi/grammars/synth"
+	"github.com/KeitaTakenouchi/grammars/unparse"
+)
+
+var (
+	traceFlag = flag.Bool("trace", false, "print the trace of the evaluation")
+	debugFlag = flag.String("debug", "", "debug the evaluation, stopping at the comma-separated symbols or at every node with \"step\"")
 )
 
 func main() {
+	flag.Parse()
 	doSQL()
 	doExp()
+	doList()
 }
 
 func doExp() {
@@ -37,68 +53,19 @@ func doExp() {
 
 	fmt.Println(gram)
 
-	var eval func(*dsl.ProgramTree, dsl.Env) dsl.EvalResult
-	eval = func(node *dsl.ProgramTree, env dsl.Env) dsl.EvalResult {
-		var ret dsl.EvalResult
-		switch node.Symbol {
-		case plus:
-			e1, ok := eval(node.Children[0], env).Value()
-			if !ok {
-				return dsl.NewEvalResult(nil)
-			}
-			e2, ok := eval(node.Children[1], env).Value()
-			if !ok {
-				return dsl.NewEvalResult(nil)
-			}
-			v1 := e1.(int)
-			v2 := e2.(int)
-			ret = dsl.NewEvalResult(v1 + v2)
-		case minus:
-			e1, ok := eval(node.Children[0], env).Value()
-			if !ok {
-				return dsl.NewEvalResult(nil)
-			}
-			e2, ok := eval(node.Children[1], env).Value()
-			if !ok {
-				return dsl.NewEvalResult(nil)
-			}
-			v1 := e1.(int)
-			v2 := e2.(int)
-			ret = dsl.NewEvalResult(v1 - v2)
-		case mult:
-			e1, ok := eval(node.Children[0], env).Value()
-			if !ok {
-				return dsl.NewEvalResult(nil)
-			}
-			e2, ok := eval(node.Children[1], env).Value()
-			if !ok {
-				return dsl.NewEvalResult(nil)
-			}
-			v1 := e1.(int)
-			v2 := e2.(int)
-			ret = dsl.NewEvalResult(v1 * v2)
-		case cnst:
-			val, err := node.Value()
-			if !err {
-				log.Fatal("the const doesn't hava the value")
-			}
-			ret = dsl.NewEvalResult(val)
-		case param:
-			i, err := node.Value()
-			if !err {
-				log.Fatal("the const doesn't hava the value")
-			}
-			ret = dsl.NewEvalResult(env.GetArg(i.(int)))
-		default:
-			// S, exp,
-			if len(node.Children) == 0 {
-				return dsl.NewEvalResult(nil)
-			}
-			ret = eval(node.Children[0], env)
-		}
-		return ret
-	}
-	evaluator := dsl.NewEvaluator(eval)
+	consts := dsl.NewSlot[int](cnst)
+	params := dsl.NewSlot[int](param)
+
+	// the semantics is keyed by symbol ids, so it can be reused by other
+	// grammars of arithmetic expressions
+	arith := dsl.NewModule("arith").
+		Define("add", dsl.Binary(func(v1, v2 int) int { return v1 + v2 })).
+		Define("minus", dsl.Binary(func(v1, v2 int) int { return v1 - v2 })).
+		Define("mult", dsl.Binary(func(v1, v2 int) int { return v1 * v2 })).
+		DefineLeaf("const", dsl.Constant).
+		DefineLeaf("param", dsl.Argument)
+	semantics := dsl.NewSemantics(&gram).Use(arith).MarkPure()
+	evaluator := semantics.Evaluator()
 
 	// Create a program tree to be evaluated.
 	nodeS := dsl.NewProgramTree(S)
@@ -106,13 +73,13 @@ func doExp() {
 	nodeMinus := dsl.NewProgramTree(minus)
 	nodeMult := dsl.NewProgramTree(mult)
 
-	nodeC1 := dsl.NewProgramTree(cnst).With(1)
-	nodeC2 := dsl.NewProgramTree(cnst).With(2)
-	nodeC3 := dsl.NewProgramTree(cnst).With(3)
-	nodeC4 := dsl.NewProgramTree(cnst).With(4)
+	nodeC1 := consts.New(1)
+	nodeC2 := consts.New(2)
+	nodeC3 := consts.New(3)
+	nodeC4 := consts.New(4)
 
-	nodeP0 := dsl.NewProgramTree(param).With(0)
-	nodeP1 := dsl.NewProgramTree(param).With(1)
+	nodeP0 := params.New(0)
+	nodeP1 := params.New(1)
 	_, _, _, _, _, _ = nodeC1, nodeC2, nodeC3, nodeC4, nodeP0, nodeP1
 
 	nodeS.AddChildren(nodeMult)
@@ -123,10 +90,68 @@ func doExp() {
 	fmt.Println(nodeS.String())
 	fmt.Println(nodeS.FormattedString())
 
+	printer := unparse.New(&gram).
+		Infix(plus, "+", 1, unparse.Left).
+		Infix(minus, "-", 1, unparse.Left).
+		Infix(mult, "*", 2, unparse.Left).
+		Atom(param, func(v interface{}) string { return fmt.Sprintf("x%v", v) })
+
+	fmt.Println(printer.Unparse(nodeS))
+
 	env := dsl.NewEnv(100, 200)
-	result := evaluator.Eval(nodeS, env)
-	v, _ := result.Value()
+	v, _ := dsl.EvalAs[int](&evaluator, nodeS, env).Value()
 	fmt.Printf("RESULT = %v\n", v)
+	if *traceFlag {
+		trace := dsl.NewTrace()
+		evaluator.Eval(nodeS, env.WithTracer(trace))
+		fmt.Print(trace)
+		b, err := json.Marshal(trace)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(b))
+	}
+	if *debugFlag != "" {
+		d := debugger.New(os.Stdin, os.Stdout)
+		if *debugFlag != "step" {
+			d.Continue()
+			for _, id := range strings.Split(*debugFlag, ",") {
+				d.Break(id)
+			}
+		}
+		evaluator.Eval(nodeS, env.WithTracer(d))
+	}
+	fmt.Printf("SIZE = %d, DEPTH = %d, COST = %v\n", nodeS.Size(), nodeS.Depth(),
+		nodeS.Cost(dsl.WeightedCost(map[*dsl.Symbol]float64{mult: 2}, 1)))
+
+	// Simplify a program with the algebraic identities of the DSL.
+	rules, err := rewrite.ParseRules(&gram, `
+		exp(add(?x, exp(const(0)))) => ?x
+		exp(add(exp(const(0)), ?x)) => ?x
+		exp(minus(?x, exp(const(0)))) => ?x
+		exp(mult(?x, exp(const(1)))) => ?x
+		exp(mult(exp(const(1)), ?x)) => ?x
+		exp(mult(?x, exp(const(0)))) => exp(const(0))
+		exp(mult(exp(const(0)), ?x)) => exp(const(0))
+		exp(minus(?x, ?x)) => exp(const(0))
+	`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	redundant, err := rewrite.ParseTree(&gram,
+		"S(exp(mult(exp(add(exp(param(0)), exp(minus(exp(const(2)), exp(const(2)))))), exp(const(1)))))")
+	if err != nil {
+		log.Fatal(err)
+	}
+	rewriter := rewrite.NewRewriter(rewrite.Innermost, rules...)
+	simplified, _, err := rewriter.Rewrite(redundant)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(redundant.String(), "=>", simplified.String())
+
+	// Fold the closed subtrees into constants and simplify the rest.
+	fmt.Println(printer.Unparse(redundant), "=>", printer.Unparse(semantics.PartialEval(redundant, cnst, rewriter.Simplifier())))
 
 	filler := func(symbol *dsl.Symbol, example synth.Example) []interface{} {
 		var ret []interface{}
@@ -143,9 +168,108 @@ func doExp() {
 		return ret
 	}
 	synthesizer := synth.NewSynthesizer(gram, evaluator, filler)
-	ex := synth.NewExample(7, 3)
+	synthesizer.SetObserver(synth.NewLogger(os.Stdout))
+	options := synth.DefaultOptions()
+	options.Timeout = time.Minute
+	synthesizer.SetOptions(options)
+	synthesizer.SetEvalLimits(dsl.Limits{MaxSteps: 1000, MaxDepth: 100})
+	cache := dsl.NewEvalCache(1 << 16)
+	synthesizer.SetCache(cache)
+	intervals := absint.IntervalDomain{}
+	synthesizer.SetPruner(absint.NewInterpreter(intervals).
+		Register(plus, absint.IntervalBinary(absint.Interval.Add)).
+		Register(minus, absint.IntervalBinary(absint.Interval.Sub)).
+		Register(mult, absint.IntervalBinary(absint.Interval.Mul)).
+		Register(cnst, absint.Constant(intervals)).
+		Register(param, absint.Argument(intervals)))
+	// 3 => 7 alone is fit by 2 + 2 + x0
+	examples := synth.NewExampleSet(synth.NewExample(7, 3), synth.NewExample(9, 4))
 	fmt.Println("------- START SEARCH -------")
-	synthesizer.Execute(ex)
+	if _, err := synthesizer.ExecuteExamples(examples); err != nil {
+		log.Fatal(err)
+	}
+	stats := cache.Stats()
+	fmt.Printf("CACHE: hits = %d, misses = %d, hit rate = %.2f\n", stats.Hits, stats.Misses, stats.HitRate())
+	fmt.Println("PRUNED =", synthesizer.Pruned())
+
+	// (x0 + 1) * (x0 + 2) is beyond the reach of the top-down search, and
+	// bottom-up keeps one expression per outputs on the examples.
+	bottomUp := synth.NewSynthesizer(gram, evaluator, filler)
+	bottomUp.SetObserver(synth.NewLogger(os.Stdout))
+	bottomUp.SetOptions(synth.Options{Strategy: synth.BottomUp, Timeout: time.Minute})
+	bottomUp.SetEvalLimits(dsl.Limits{MaxSteps: 1000, MaxDepth: 100})
+	examples = synth.NewExampleSet(synth.NewExample(20, 3), synth.NewExample(30, 4), synth.NewExample(42, 5))
+	fmt.Println("------- START BOTTOM-UP SEARCH -------")
+	if _, err := bottomUp.ExecuteExamples(examples); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func doList() {
+	S := dsl.NewSymbol("S")
+
+	lst := dsl.NewSymbol("lst")
+	fun := dsl.NewSymbol("fun")
+	exp := dsl.NewSymbol("exp")
+
+	mapf := dsl.NewSymbol("map")
+	lambda := dsl.NewSymbol("lambda")
+	plus := dsl.NewSymbol("add")
+	mult := dsl.NewSymbol("mult")
+	v := dsl.NewSymbol("var")
+	cnst := dsl.NewSymbol("const")
+	input := dsl.NewSymbol("input")
+
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, lst)
+	gram.AddRule(lst, mapf)
+	gram.AddRule(lst, input)
+	gram.AddRule(mapf, fun, lst)
+	gram.AddRule(fun, lambda)
+	gram.AddRule(lambda, exp)
+	gram.AddRule(exp, plus)
+	gram.AddRule(exp, mult)
+	gram.AddRule(exp, v)
+	gram.AddRule(exp, cnst)
+	gram.AddRule(plus, exp, exp)
+	gram.AddRule(mult, exp, exp)
+
+	evaluator := dsl.NewSemantics(&gram).
+		Register(mapf, dsl.ListMap).
+		RegisterForm(lambda, dsl.Lambda).
+		Register(plus, dsl.Binary(func(v1, v2 int) int { return v1 + v2 })).
+		Register(mult, dsl.Binary(func(v1, v2 int) int { return v1 * v2 })).
+		RegisterLeaf(v, dsl.Variable).
+		RegisterLeaf(cnst, dsl.Constant).
+		RegisterLeaf(input, dsl.Argument).
+		MarkPure().
+		Evaluator()
+
+	// the parameters of lambdas are in scope in their bodies
+	filler := func(symbol *dsl.Symbol, scope []string, example synth.Example) []interface{} {
+		var ret []interface{}
+		switch symbol {
+		case v:
+			for _, name := range scope {
+				ret = append(ret, name)
+			}
+		case cnst:
+			ret = append(ret, 1, 2)
+		case input:
+			ret = append(ret, 0)
+		}
+		return ret
+	}
+	synthesizer := synth.NewSynthesizer(gram, evaluator, nil)
+	synthesizer.SetScoping(dsl.NewScoping().Bind(lambda, 0))
+	synthesizer.SetScopedFiller(filler)
+	synthesizer.SetObserver(synth.NewLogger(os.Stdout))
+	synthesizer.SetEvalLimits(dsl.Limits{MaxSteps: 1000, MaxDepth: 100})
+	ex := synth.NewExample([]interface{}{3, 5, 7}, []interface{}{1, 2, 3})
+	fmt.Println("------- START SEARCH -------")
+	if _, err := synthesizer.Execute(ex); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func doSQL() {
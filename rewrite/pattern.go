@@ -0,0 +1,355 @@
+package rewrite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+// Pattern is a program tree with metavariables. A pattern with Var set
+// matches any subtree, otherwise it matches nodes of Symbol with matching
+// children. The value of the node must equal Value if it is set, is bound
+// to ValueVar if that is set, and is not checked otherwise.
+//
+// In the textual syntax `?x` is a subtree metavariable, `sym` a node
+// without children and `sym(args...)` a node with children. The first
+// argument may be a literal (integer, float, quoted string, true or false)
+// or a value metavariable `$v`, which constrains the value of the node:
+//
+//	add(?x, const(0)) => ?x
+//	mult(const($a), const($a)) => square(const($a))
+type Pattern struct {
+	Var      string
+	Symbol   *dsl.Symbol
+	Value    interface{}
+	ValueVar string
+	Children []*Pattern
+}
+
+func (p *Pattern) IsVar() bool {
+	return p.Var != ""
+}
+
+func (p *Pattern) String() string {
+	if p.IsVar() {
+		return "?" + p.Var
+	}
+	args := make([]string, 0, len(p.Children)+1)
+	if p.ValueVar != "" {
+		args = append(args, "$"+p.ValueVar)
+	} else if p.Value != nil {
+		args = append(args, formatLiteral(p.Value))
+	}
+	for _, c := range p.Children {
+		args = append(args, c.String())
+	}
+	if len(args) == 0 {
+		return p.Symbol.Id
+	}
+	return p.Symbol.Id + "(" + strings.Join(args, ", ") + ")"
+}
+
+func formatLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eEnN") {
+			s += ".0"
+		}
+		return s
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func (p *Pattern) vars(trees, values map[string]struct{}) {
+	if p.IsVar() {
+		trees[p.Var] = struct{}{}
+		return
+	}
+	if p.ValueVar != "" {
+		values[p.ValueVar] = struct{}{}
+	}
+	for _, c := range p.Children {
+		c.vars(trees, values)
+	}
+}
+
+type Bindings struct {
+	Trees  map[string]*dsl.ProgramTree
+	Values map[string]interface{}
+}
+
+func newBindings() Bindings {
+	return Bindings{
+		Trees:  make(map[string]*dsl.ProgramTree),
+		Values: make(map[string]interface{}),
+	}
+}
+
+// Match matches the pattern against the root of the tree. A metavariable
+// occurring more than once must be bound to equal subtrees or values.
+func Match(p *Pattern, t *dsl.ProgramTree) (Bindings, bool) {
+	b := newBindings()
+	if !match(p, t, b) {
+		return Bindings{}, false
+	}
+	return b, true
+}
+
+func match(p *Pattern, t *dsl.ProgramTree, b Bindings) bool {
+	if p.IsVar() {
+		if bound, ok := b.Trees[p.Var]; ok {
+			return dsl.Equal(bound, t)
+		}
+		b.Trees[p.Var] = t
+		return true
+	}
+	if p.Symbol != t.Symbol || len(p.Children) != len(t.Children) {
+		return false
+	}
+	val, hasVal := t.Value()
+	if p.Value != nil && (!hasVal || !dsl.EqualValue(p.Value, val)) {
+		return false
+	}
+	if p.ValueVar != "" {
+		if !hasVal {
+			return false
+		}
+		if bound, ok := b.Values[p.ValueVar]; ok {
+			if !dsl.EqualValue(bound, val) {
+				return false
+			}
+		} else {
+			b.Values[p.ValueVar] = val
+		}
+	}
+	for i, c := range p.Children {
+		if !match(c, t.Children[i], b) {
+			return false
+		}
+	}
+	return true
+}
+
+// Instantiate builds the tree of the pattern with the metavariables
+// replaced by copies of their bindings.
+func Instantiate(p *Pattern, b Bindings) (*dsl.ProgramTree, error) {
+	if p.IsVar() {
+		t, ok := b.Trees[p.Var]
+		if !ok {
+			return nil, fmt.Errorf("unbound metavariable ?%s", p.Var)
+		}
+		return t.Clone(), nil
+	}
+	t := dsl.NewProgramTree(p.Symbol)
+	if p.ValueVar != "" {
+		val, ok := b.Values[p.ValueVar]
+		if !ok {
+			return nil, fmt.Errorf("unbound metavariable $%s", p.ValueVar)
+		}
+		t.With(val)
+	} else if p.Value != nil {
+		t.With(p.Value)
+	}
+	for _, c := range p.Children {
+		child, err := Instantiate(c, b)
+		if err != nil {
+			return nil, err
+		}
+		t.AddChildren(child)
+	}
+	return t, nil
+}
+
+func ParsePattern(g *dsl.Grammar, src string) (*Pattern, error) {
+	ps := newParser(g, src)
+	p, err := ps.pattern()
+	if err != nil {
+		return nil, err
+	}
+	if !ps.eof() {
+		return nil, ps.errorf("unexpected %q", ps.rest())
+	}
+	return p, nil
+}
+
+// ParseTree parses a pattern without metavariables as a program tree.
+func ParseTree(g *dsl.Grammar, src string) (*dsl.ProgramTree, error) {
+	p, err := ParsePattern(g, src)
+	if err != nil {
+		return nil, err
+	}
+	return Instantiate(p, newBindings())
+}
+
+type parser struct {
+	grammar *dsl.Grammar
+	src     []rune
+	pos     int
+}
+
+func newParser(g *dsl.Grammar, src string) *parser {
+	return &parser{
+		grammar: g,
+		src:     []rune(src),
+	}
+}
+
+func (ps *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at offset %d of %q", fmt.Sprintf(format, args...), ps.pos, string(ps.src))
+}
+
+func (ps *parser) skipSpaces() {
+	for ps.pos < len(ps.src) && unicode.IsSpace(ps.src[ps.pos]) {
+		ps.pos++
+	}
+}
+
+func (ps *parser) eof() bool {
+	ps.skipSpaces()
+	return ps.pos >= len(ps.src)
+}
+
+func (ps *parser) rest() string {
+	return string(ps.src[ps.pos:])
+}
+
+func (ps *parser) peek() rune {
+	if ps.eof() {
+		return 0
+	}
+	return ps.src[ps.pos]
+}
+
+func (ps *parser) consume(r rune) bool {
+	if ps.peek() == r {
+		ps.pos++
+		return true
+	}
+	return false
+}
+
+func (ps *parser) hasPrefix(s string) bool {
+	ps.skipSpaces()
+	// comparing the runes in place doesn't copy the rest of the source
+	for i, r := range []rune(s) {
+		if ps.pos+i >= len(ps.src) || ps.src[ps.pos+i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune("()?$\",=", r)
+}
+
+func (ps *parser) ident() string {
+	ps.skipSpaces()
+	start := ps.pos
+	for ps.pos < len(ps.src) && isIdentRune(ps.src[ps.pos]) {
+		ps.pos++
+	}
+	return string(ps.src[start:ps.pos])
+}
+
+func (ps *parser) pattern() (*Pattern, error) {
+	if ps.consume('?') {
+		name := ps.ident()
+		if name == "" {
+			return nil, ps.errorf("missing name of the metavariable")
+		}
+		return &Pattern{Var: name}, nil
+	}
+	id := ps.ident()
+	if id == "" {
+		return nil, ps.errorf("missing symbol")
+	}
+	s, ok := ps.grammar.GetSymbol(id)
+	if !ok {
+		return nil, ps.errorf("unknown symbol %q", id)
+	}
+	p := &Pattern{Symbol: s}
+	if !ps.consume('(') {
+		return p, nil
+	}
+	for first := true; !ps.consume(')'); first = false {
+		if !first && !ps.consume(',') {
+			return nil, ps.errorf("missing ',' or ')'")
+		}
+		if first {
+			ok, err := ps.valueArg(p)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				continue
+			}
+		}
+		c, err := ps.pattern()
+		if err != nil {
+			return nil, err
+		}
+		p.Children = append(p.Children, c)
+	}
+	return p, nil
+}
+
+func (ps *parser) valueArg(p *Pattern) (bool, error) {
+	r := ps.peek()
+	switch {
+	case r == '$':
+		ps.pos++
+		name := ps.ident()
+		if name == "" {
+			return false, ps.errorf("missing name of the metavariable")
+		}
+		p.ValueVar = name
+		return true, nil
+	case r == '"':
+		start := ps.pos
+		for ps.pos++; ps.pos < len(ps.src) && ps.src[ps.pos] != '"'; ps.pos++ {
+			if ps.src[ps.pos] == '\\' {
+				ps.pos++
+			}
+		}
+		if ps.pos >= len(ps.src) {
+			return false, ps.errorf("unterminated string")
+		}
+		ps.pos++
+		s, err := strconv.Unquote(string(ps.src[start:ps.pos]))
+		if err != nil {
+			return false, ps.errorf("invalid string: %v", err)
+		}
+		p.Value = s
+		return true, nil
+	case r == '-' || unicode.IsDigit(r):
+		start := ps.pos
+		lit := ps.ident()
+		if i, err := strconv.Atoi(lit); err == nil {
+			p.Value = i
+			return true, nil
+		}
+		if f, err := strconv.ParseFloat(lit, 64); err == nil {
+			p.Value = f
+			return true, nil
+		}
+		ps.pos = start
+		return false, nil
+	case ps.hasPrefix("true") || ps.hasPrefix("false"):
+		start := ps.pos
+		lit := ps.ident()
+		if _, ok := ps.grammar.GetSymbol(lit); ok || (lit != "true" && lit != "false") {
+			ps.pos = start
+			return false, nil
+		}
+		p.Value = lit == "true"
+		return true, nil
+	}
+	return false, nil
+}
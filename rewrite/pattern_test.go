@@ -0,0 +1,159 @@
+package rewrite
+
+import (
+	"testing"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+func newExpGrammar() dsl.Grammar {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	plus := dsl.NewSymbol("add")
+	minus := dsl.NewSymbol("minus")
+	mult := dsl.NewSymbol("mult")
+	cnst := dsl.NewSymbol("const")
+	param := dsl.NewSymbol("param")
+
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, exp)
+	gram.AddRule(exp, plus)
+	gram.AddRule(exp, minus)
+	gram.AddRule(exp, mult)
+	gram.AddRule(exp, cnst)
+	gram.AddRule(exp, param)
+	gram.AddRule(plus, exp, exp)
+	gram.AddRule(minus, exp, exp)
+	gram.AddRule(mult, exp, exp)
+	return gram
+}
+
+func mustParseTree(t *testing.T, g *dsl.Grammar, src string) *dsl.ProgramTree {
+	t.Helper()
+	tree, err := ParseTree(g, src)
+	if err != nil {
+		t.Fatalf("ParseTree(%q) error = %v", src, err)
+	}
+	return tree
+}
+
+func TestParsePattern(t *testing.T) {
+	g := newExpGrammar()
+
+	tests := []struct {
+		name    string
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{name: "metavariable", src: "?x", want: "?x"},
+		{name: "leaf", src: "exp", want: "exp"},
+		{name: "nested", src: "add( ?x ,exp(const(0)))", want: "add(?x, exp(const(0)))"},
+		{name: "value metavariable", src: "const($v)", want: "const($v)"},
+		{name: "negative int", src: "const(-3)", want: "const(-3)"},
+		{name: "float", src: "const(1.5)", want: "const(1.5)"},
+		{name: "string", src: `const("a\"b")`, want: `const("a\"b")`},
+		{name: "bool", src: "const(true)", want: "const(true)"},
+		{name: "unknown symbol", src: "foo(?x)", wantErr: true},
+		{name: "unclosed", src: "add(?x, ?y", wantErr: true},
+		{name: "trailing", src: "add(?x, ?y) ?z", wantErr: true},
+		{name: "empty metavariable", src: "add(?, ?y)", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePattern(&g, tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePattern() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("ParsePattern() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	g := newExpGrammar()
+
+	tests := []struct {
+		name       string
+		pattern    string
+		tree       string
+		wantOk     bool
+		wantTrees  map[string]string
+		wantValues map[string]interface{}
+	}{
+		{
+			name:      "bind subtrees",
+			pattern:   "add(?x, ?y)",
+			tree:      "add(exp(const(1)), exp(param(0)))",
+			wantOk:    true,
+			wantTrees: map[string]string{"x": `exp["const"(1)]`, "y": `exp["param"(0)]`},
+		},
+		{
+			name:    "literal value",
+			pattern: "add(?x, exp(const(0)))",
+			tree:    "add(exp(const(1)), exp(const(0)))",
+			wantOk:  true,
+		},
+		{
+			name:    "literal value mismatch",
+			pattern: "add(?x, exp(const(0)))",
+			tree:    "add(exp(const(1)), exp(const(2)))",
+			wantOk:  false,
+		},
+		{
+			name:    "non-linear",
+			pattern: "minus(?x, ?x)",
+			tree:    "minus(exp(param(0)), exp(param(0)))",
+			wantOk:  true,
+		},
+		{
+			name:    "non-linear mismatch",
+			pattern: "minus(?x, ?x)",
+			tree:    "minus(exp(param(0)), exp(param(1)))",
+			wantOk:  false,
+		},
+		{
+			name:       "value metavariable",
+			pattern:    "mult(exp(const($a)), exp(const($a)))",
+			tree:       "mult(exp(const(3)), exp(const(3)))",
+			wantOk:     true,
+			wantValues: map[string]interface{}{"a": 3},
+		},
+		{
+			name:    "value metavariable without value",
+			pattern: "exp(const($a))",
+			tree:    "exp(const)",
+			wantOk:  false,
+		},
+		{
+			name:    "symbol mismatch",
+			pattern: "add(?x, ?y)",
+			tree:    "mult(exp, exp)",
+			wantOk:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePattern(&g, tt.pattern)
+			if err != nil {
+				t.Fatalf("ParsePattern() error = %v", err)
+			}
+			b, ok := Match(p, mustParseTree(t, &g, tt.tree))
+			if ok != tt.wantOk {
+				t.Fatalf("Match() ok = %v, want %v", ok, tt.wantOk)
+			}
+			for v, want := range tt.wantTrees {
+				if got := b.Trees[v]; got == nil || got.String() != want {
+					t.Errorf("Match() binds ?%s to %v, want %v", v, got, want)
+				}
+			}
+			for v, want := range tt.wantValues {
+				if got := b.Values[v]; got != want {
+					t.Errorf("Match() binds $%s to %v, want %v", v, got, want)
+				}
+			}
+		})
+	}
+}
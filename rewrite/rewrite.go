@@ -0,0 +1,244 @@
+package rewrite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+var ErrStepLimit = errors.New("rewrite: step limit exceeded")
+
+type Rule struct {
+	Lhs *Pattern
+	Rhs *Pattern
+}
+
+func (r Rule) String() string {
+	return r.Lhs.String() + " => " + r.Rhs.String()
+}
+
+// Apply rewrites the root of the tree if the left-hand side matches it.
+func (r Rule) Apply(t *dsl.ProgramTree) (*dsl.ProgramTree, bool) {
+	b, ok := Match(r.Lhs, t)
+	if !ok {
+		return nil, false
+	}
+	ret, err := Instantiate(r.Rhs, b)
+	if err != nil {
+		// the right-hand side only uses variables of the left-hand side
+		panic(err)
+	}
+	return ret, true
+}
+
+func NewRule(lhs, rhs *Pattern) (Rule, error) {
+	if lhs.IsVar() {
+		return Rule{}, fmt.Errorf("the left-hand side %s matches every tree", lhs)
+	}
+	lTrees, lValues := make(map[string]struct{}), make(map[string]struct{})
+	lhs.vars(lTrees, lValues)
+	rTrees, rValues := make(map[string]struct{}), make(map[string]struct{})
+	rhs.vars(rTrees, rValues)
+	for v := range rTrees {
+		if _, ok := lTrees[v]; !ok {
+			return Rule{}, fmt.Errorf("metavariable ?%s is not bound by %s", v, lhs)
+		}
+	}
+	for v := range rValues {
+		if _, ok := lValues[v]; !ok {
+			return Rule{}, fmt.Errorf("metavariable $%s is not bound by %s", v, lhs)
+		}
+	}
+	return Rule{Lhs: lhs, Rhs: rhs}, nil
+}
+
+// ParseRule parses a rule of the form `lhs => rhs`, where the arrow is
+// the one after the left-hand side and not one in a string literal.
+func ParseRule(g *dsl.Grammar, src string) (Rule, error) {
+	ps := newParser(g, src)
+	lhs, err := ps.pattern()
+	if err != nil {
+		return Rule{}, err
+	}
+	if !ps.hasPrefix("=>") {
+		return Rule{}, fmt.Errorf("rule %q must have the form lhs => rhs", src)
+	}
+	ps.pos += len("=>")
+	rhs, err := ps.pattern()
+	if err != nil {
+		return Rule{}, err
+	}
+	if !ps.eof() {
+		return Rule{}, ps.errorf("unexpected %q", ps.rest())
+	}
+	return NewRule(lhs, rhs)
+}
+
+// ParseRules parses one rule per line, skipping blank lines and comments
+// starting with '#'.
+func ParseRules(g *dsl.Grammar, src string) ([]Rule, error) {
+	ret := make([]Rule, 0)
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := ParseRule(g, line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+type Strategy int
+
+const (
+	// Innermost normalizes the children of a node before rewriting it.
+	Innermost Strategy = iota
+	// Outermost rewrites the first redex in pre-order until none is left.
+	Outermost
+	// Once rewrites the first redex in pre-order only.
+	Once
+)
+
+const defaultMaxSteps = 10000
+
+type Rewriter struct {
+	rules    []Rule
+	strategy Strategy
+	maxSteps int
+}
+
+func NewRewriter(strategy Strategy, rules ...Rule) *Rewriter {
+	return &Rewriter{
+		rules:    rules,
+		strategy: strategy,
+		maxSteps: defaultMaxSteps,
+	}
+}
+
+func (r *Rewriter) SetMaxSteps(n int) {
+	r.maxSteps = n
+}
+
+func (r *Rewriter) apply(t *dsl.ProgramTree) (*dsl.ProgramTree, bool) {
+	for _, rule := range r.rules {
+		if ret, ok := rule.Apply(t); ok {
+			return ret, true
+		}
+	}
+	return nil, false
+}
+
+// Rewrite returns the rewritten copy of the tree and the number of rewrite
+// steps. If the step limit is hit, it returns the tree rewritten so far and
+// ErrStepLimit.
+func (r *Rewriter) Rewrite(t *dsl.ProgramTree) (*dsl.ProgramTree, int, error) {
+	steps := 0
+	switch r.strategy {
+	case Innermost:
+		ret, ok := r.innermost(t, &steps, make(map[*dsl.ProgramTree]struct{}))
+		if !ok {
+			return ret, steps, ErrStepLimit
+		}
+		return ret, steps, nil
+	case Once:
+		ret, _ := r.outermostStep(t.Clone(), &steps)
+		return ret, steps, nil
+	default:
+		ret := t.Clone()
+		for {
+			if steps >= r.maxSteps {
+				return ret, steps, ErrStepLimit
+			}
+			next, ok := r.outermostStep(ret, &steps)
+			if !ok {
+				return ret, steps, nil
+			}
+			ret = next
+		}
+	}
+}
+
+// Simplifier returns the dsl.Simplifier rewriting the tree, which gives
+// the tree rewritten so far when the step limit is hit.
+func (r *Rewriter) Simplifier() dsl.Simplifier {
+	return func(t *dsl.ProgramTree) *dsl.ProgramTree {
+		ret, _, _ := r.Rewrite(t)
+		return ret
+	}
+}
+
+// innermost returns the normal form of the tree, or the tree rewritten so
+// far and false when the step limit is hit. The nodes in normal are the
+// normal forms built so far, which are not normalized again.
+func (r *Rewriter) innermost(t *dsl.ProgramTree, steps *int, normal map[*dsl.ProgramTree]struct{}) (*dsl.ProgramTree, bool) {
+	if _, ok := normal[t]; ok {
+		return t, true
+	}
+	cpy := dsl.NewProgramTree(t.Symbol)
+	if val, ok := t.Value(); ok {
+		cpy.With(val)
+	}
+	done := true
+	for _, c := range t.Children {
+		if !done {
+			cpy.AddChildren(c.Clone())
+			continue
+		}
+		var child *dsl.ProgramTree
+		child, done = r.innermost(c, steps, normal)
+		cpy.AddChildren(child)
+	}
+	if !done {
+		return cpy, false
+	}
+	next, ok := r.applyNormal(cpy, normal)
+	if !ok {
+		normal[cpy] = struct{}{}
+		return cpy, true
+	}
+	if *steps >= r.maxSteps {
+		return cpy, false
+	}
+	*steps++
+	// the nodes built by the right-hand side may be new redexes, while the
+	// copies of the bindings are normal forms
+	return r.innermost(next, steps, normal)
+}
+
+// applyNormal is apply for the tree whose children are normal forms, which
+// marks the copies of the bindings in the result normal.
+func (r *Rewriter) applyNormal(t *dsl.ProgramTree, normal map[*dsl.ProgramTree]struct{}) (*dsl.ProgramTree, bool) {
+	for _, rule := range r.rules {
+		if ret, ok := rule.Apply(t); ok {
+			markBindings(rule.Rhs, ret, normal)
+			return ret, true
+		}
+	}
+	return nil, false
+}
+
+func markBindings(p *Pattern, t *dsl.ProgramTree, normal map[*dsl.ProgramTree]struct{}) {
+	if p.IsVar() {
+		normal[t] = struct{}{}
+		return
+	}
+	for i, c := range p.Children {
+		markBindings(c, t.Children[i], normal)
+	}
+}
+
+func (r *Rewriter) outermostStep(t *dsl.ProgramTree, steps *int) (*dsl.ProgramTree, bool) {
+	for p, n := range t.PreOrder() {
+		if next, ok := r.apply(n); ok {
+			*steps++
+			return t.Replace(p, next), true
+		}
+	}
+	return t, false
+}
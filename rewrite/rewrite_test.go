@@ -0,0 +1,189 @@
+package rewrite
+
+import (
+	"testing"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+const arithRules = `
+# identities of the expression DSL
+exp(add(?x, exp(const(0)))) => ?x
+exp(add(exp(const(0)), ?x)) => ?x
+exp(mult(?x, exp(const(1)))) => ?x
+exp(mult(exp(const(1)), ?x)) => ?x
+exp(minus(?x, ?x)) => exp(const(0))
+`
+
+func TestParseRules(t *testing.T) {
+	g := newExpGrammar()
+
+	tests := []struct {
+		name    string
+		src     string
+		want    int
+		wantErr bool
+	}{
+		{name: "rules with comments", src: arithRules, want: 5},
+		{name: "unbound metavariable", src: "add(?x, ?y) => ?z", wantErr: true},
+		{name: "unbound value metavariable", src: "const => const($v)", wantErr: true},
+		{name: "variable left-hand side", src: "?x => exp", wantErr: true},
+		{name: "missing arrow", src: "add(?x, ?y)", wantErr: true},
+		{name: "arrow in a string", src: `exp(const("=>")) => exp(const("->"))`, want: 1},
+		{name: "two arrows", src: "exp(?x) => ?x => ?x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRules(&g, tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(got) != tt.want {
+				t.Errorf("ParseRules() = %v, want %d rules", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriter_Rewrite(t *testing.T) {
+	g := newExpGrammar()
+	rules, err := ParseRules(&g, arithRules)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	// ((x0 - x0) + x1) * 1
+	src := "S(exp(mult(exp(add(exp(minus(exp(param(0)), exp(param(0)))), exp(param(1)))), exp(const(1)))))"
+
+	tests := []struct {
+		name      string
+		strategy  Strategy
+		want      string
+		wantSteps int
+	}{
+		{
+			name:      "innermost",
+			strategy:  Innermost,
+			want:      "S(exp(param(1)))",
+			wantSteps: 3,
+		},
+		{
+			name:      "outermost",
+			strategy:  Outermost,
+			want:      "S(exp(param(1)))",
+			wantSteps: 3,
+		},
+		{
+			name:      "once",
+			strategy:  Once,
+			want:      "S(exp(add(exp(minus(exp(param(0)), exp(param(0)))), exp(param(1)))))",
+			wantSteps: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := mustParseTree(t, &g, src)
+			got, steps, err := NewRewriter(tt.strategy, rules...).Rewrite(tree)
+			if err != nil {
+				t.Fatalf("Rewriter.Rewrite() error = %v", err)
+			}
+			if want := mustParseTree(t, &g, tt.want); got.String() != want.String() {
+				t.Errorf("Rewriter.Rewrite() = %v, want %v", got, want)
+			}
+			if steps != tt.wantSteps {
+				t.Errorf("Rewriter.Rewrite() steps = %d, want %d", steps, tt.wantSteps)
+			}
+			if tree.String() != mustParseTree(t, &g, src).String() {
+				t.Errorf("Rewriter.Rewrite() modified the input to %v", tree)
+			}
+		})
+	}
+}
+
+func TestRewriter_StepLimit(t *testing.T) {
+	g := newExpGrammar()
+	// commutativity never reaches a fixpoint
+	rule, err := ParseRule(&g, "add(?x, ?y) => add(?y, ?x)")
+	if err != nil {
+		t.Fatalf("ParseRule() error = %v", err)
+	}
+	tree := mustParseTree(t, &g, "add(exp(const(1)), exp(const(2)))")
+
+	for _, strategy := range []Strategy{Innermost, Outermost} {
+		r := NewRewriter(strategy, rule)
+		r.SetMaxSteps(5)
+		got, steps, err := r.Rewrite(tree)
+		if err != ErrStepLimit {
+			t.Errorf("Rewriter.Rewrite() error = %v, want %v", err, ErrStepLimit)
+		}
+		if steps != 5 {
+			t.Errorf("Rewriter.Rewrite() steps = %d, want %d", steps, 5)
+		}
+		if want := mustParseTree(t, &g, "add(exp(const(2)), exp(const(1)))"); got.String() != want.String() {
+			t.Errorf("Rewriter.Rewrite() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRewriter_Rewrite_Deep(t *testing.T) {
+	g := newExpGrammar()
+	rules, err := ParseRules(&g, arithRules)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	// x0 * 1 * 1 * ... where every rewrite returns the normal form below
+	const n = 2000
+	src := "exp(param(0))"
+	for i := 0; i < n; i++ {
+		src = "exp(mult(" + src + ", exp(const(1))))"
+	}
+	got, steps, err := NewRewriter(Innermost, rules...).Rewrite(mustParseTree(t, &g, src))
+	if err != nil {
+		t.Fatalf("Rewriter.Rewrite() error = %v", err)
+	}
+	if want := mustParseTree(t, &g, "exp(param(0))"); got.String() != want.String() || steps != n {
+		t.Errorf("Rewriter.Rewrite() = %v in %d steps, want %v in %d steps", got, steps, want, n)
+	}
+}
+
+func TestRewriter_Simplifier(t *testing.T) {
+	g := newExpGrammar()
+	rules, err := ParseRules(&g, arithRules+`
+		exp(minus(?x, exp(const(0)))) => ?x
+	`)
+	if err != nil {
+		t.Fatalf("ParseRules() error = %v", err)
+	}
+	symbol := func(id string) *dsl.Symbol {
+		s, _ := g.GetSymbol(id)
+		return s
+	}
+	semantics := dsl.NewSemantics(&g).
+		Register(symbol("add"), dsl.Binary(func(a, b int) int { return a + b })).
+		Register(symbol("minus"), dsl.Binary(func(a, b int) int { return a - b })).
+		Register(symbol("mult"), dsl.Binary(func(a, b int) int { return a * b })).
+		RegisterLeaf(symbol("const"), dsl.Constant).
+		RegisterLeaf(symbol("param"), dsl.Argument).
+		MarkPure()
+	simplify := NewRewriter(Innermost, rules...).Simplifier()
+
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		// (x0 + (2 - 2)) * 1
+		{name: "add and mult", src: "S(exp(mult(exp(add(exp(param(0)), exp(minus(exp(const(2)), exp(const(2)))))), exp(const(1)))))", want: "S(exp(param(0)))"},
+		// x0 - (1 * 0)
+		{name: "minus", src: "S(exp(minus(exp(param(0)), exp(mult(exp(const(1)), exp(const(0)))))))", want: "S(exp(param(0)))"},
+		// x0 * 2 is already simple
+		{name: "open", src: "S(exp(mult(exp(param(0)), exp(const(2)))))", want: "S(exp(mult(exp(param(0)), exp(const(2)))))"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := semantics.PartialEval(mustParseTree(t, &g, tt.src), symbol("const"), simplify)
+			if want := mustParseTree(t, &g, tt.want); got.String() != want.String() {
+				t.Errorf("Semantics.PartialEval() = %v, want %v", got, want)
+			}
+		})
+	}
+}
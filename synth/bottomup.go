@@ -0,0 +1,304 @@
+package synth
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+// bank is the programs built bottom-up, one of each symbol per distinct
+// outputs on the examples.
+type bank struct {
+	// programs of each symbol by size
+	programs map[*dsl.Symbol][][]*dsl.ProgramTree
+	keys     map[*dsl.Symbol]*valueSet
+	depths   map[*dsl.ProgramTree]int
+	size     int
+}
+
+func newBank() *bank {
+	return &bank{
+		programs: make(map[*dsl.Symbol][][]*dsl.ProgramTree),
+		keys:     make(map[*dsl.Symbol]*valueSet),
+		depths:   make(map[*dsl.ProgramTree]int),
+	}
+}
+
+// valueSet is a set of values bucketed by their hashes and compared by
+// dsl.EqualValue, like dsl.TreeSet.
+type valueSet struct {
+	buckets map[uint64][]interface{}
+}
+
+// add inserts the value and reports whether it was not in the set yet.
+func (s *valueSet) add(v interface{}) bool {
+	h := dsl.HashValue(v)
+	for _, u := range s.buckets[h] {
+		if dsl.EqualValue(v, u) {
+			return false
+		}
+	}
+	s.buckets[h] = append(s.buckets[h], v)
+	return true
+}
+
+// terminalKey is the key of a terminal kept without outputs, which is never
+// equal to the outputs of a program.
+type terminalKey struct {
+	value interface{}
+}
+
+func (b *bank) get(symbol *dsl.Symbol, size int) []*dsl.ProgramTree {
+	programs := b.programs[symbol]
+	if size >= len(programs) {
+		return nil
+	}
+	return programs[size]
+}
+
+// add keeps the program unless a program of its symbol has the same key,
+// and reports whether it is kept.
+func (b *bank) add(pgm *dsl.ProgramTree, size, depth int, key interface{}) bool {
+	keys, ok := b.keys[pgm.Symbol]
+	if !ok {
+		keys = &valueSet{buckets: make(map[uint64][]interface{})}
+		b.keys[pgm.Symbol] = keys
+	}
+	if !keys.add(key) {
+		return false
+	}
+	programs := b.programs[pgm.Symbol]
+	for len(programs) <= size {
+		programs = append(programs, nil)
+	}
+	programs[size] = append(programs[size], pgm)
+	b.programs[pgm.Symbol] = programs
+	b.depths[pgm] = depth
+	b.size++
+	return true
+}
+
+// searchBottomUp enumerates the programs by increasing size, where a node
+// adds one to the sizes of its children. Programs failing on an example are
+// dropped, so the bindings of scoping are not supported, except terminals
+// kept by their values for the parents reading them as syntax.
+func (s *Synthesizer) searchBottomUp(ctx context.Context, examples *ExampleSet) (Result, error) {
+	if s.scoping != nil {
+		return Result{}, errors.New("synth: bottom-up search doesn't support scoping")
+	}
+	opts := s.options
+	var rnd *rand.Rand
+	if opts.Seed != 0 {
+		rnd = rand.New(rand.NewSource(opts.Seed))
+	}
+
+	symbols, maxArity := s.reachableSymbols()
+	forest := dsl.NewForest()
+	bank := newBank()
+	start := s.grammar.GetStart()
+
+	var hit Bound
+	index := 0
+	var nearMiss *dsl.ProgramTree
+	satisfied := 0
+	result := func(reason StopReason) Result {
+		return Result{NearMiss: nearMiss, Satisfied: satisfied, Explored: index, Reason: reason, Hit: hit}
+	}
+	// the largest size of the kept programs, beyond which the sizes of
+	// the children can't add up
+	largest := 0
+	for size := 1; size <= largest*maxArity+1; size++ {
+		if opts.MaxSize > 0 && size > opts.MaxSize {
+			hit |= SizeBound
+			break
+		}
+		for _, symbol := range symbols {
+			var solution *dsl.ProgramTree
+			var err error
+			s.enumerate(forest, bank, symbol, size, examples.Get(0), rnd, func(pgm *dsl.ProgramTree, depth int) bool {
+				if err = ctx.Err(); err != nil {
+					return false
+				}
+				if opts.MaxCandidates > 0 && index >= opts.MaxCandidates {
+					hit |= CandidateBound
+					return false
+				}
+				index++
+				if opts.MaxDepth > 0 && depth > opts.MaxDepth {
+					hit |= DepthBound
+					return true
+				}
+				if opts.MaxSketches > 0 && bank.size >= opts.MaxSketches {
+					hit |= SketchBound
+					return false
+				}
+				outputs, err := s.outputs(ctx, pgm, examples)
+				if err != nil || outputs == nil {
+					if len(pgm.Children) > 0 || symbol == start || dsl.IsKind(err, dsl.Canceled) {
+						s.reject(err)
+						return true
+					}
+					val, _ := pgm.Value()
+					if bank.add(pgm, size, depth, terminalKey{val}) {
+						largest = size
+					}
+					return true
+				}
+				if !bank.add(pgm, size, depth, outputs) {
+					return true
+				}
+				largest = size
+				if symbol != start {
+					return true
+				}
+				n := 0
+				for i, example := range examples.Examples() {
+					if reflect.DeepEqual(outputs[i], example.GetOutput()) {
+						n++
+					}
+				}
+				if n == examples.Len() {
+					if s.observer != nil {
+						s.observer.Solution(pgm, examples, outputs)
+					}
+					solution = pgm
+					return false
+				}
+				if n > satisfied {
+					nearMiss, satisfied = pgm, n
+				}
+				return true
+			})
+			switch {
+			case solution != nil:
+				return Result{Program: solution, Satisfied: examples.Len(), Explored: index, Reason: Solved, Hit: hit}, nil
+			case err != nil:
+				return result(Stopped), err
+			case hit.Has(CandidateBound) || hit.Has(SketchBound):
+				return result(LimitReached), nil
+			}
+		}
+	}
+	if hit != 0 {
+		return result(LimitReached), nil
+	}
+	return result(Exhausted), nil
+}
+
+// reachableSymbols returns the symbols reachable from the start symbol in
+// breadth first order, and the largest number of symbols of a rule.
+func (s *Synthesizer) reachableSymbols() ([]*dsl.Symbol, int) {
+	start := s.grammar.GetStart()
+	symbols := []*dsl.Symbol{start}
+	seen := map[*dsl.Symbol]struct{}{start: struct{}{}}
+	maxArity := 1
+	for i := 0; i < len(symbols); i++ {
+		// GetRhs makes the symbol nonterminal
+		if symbols[i].IsTerminal() {
+			continue
+		}
+		for _, seq := range s.grammar.GetRhs(symbols[i]) {
+			if len(seq) > maxArity {
+				maxArity = len(seq)
+			}
+			for _, symbol := range seq {
+				if _, ok := seen[symbol]; !ok {
+					seen[symbol] = struct{}{}
+					symbols = append(symbols, symbol)
+				}
+			}
+		}
+	}
+	return symbols, maxArity
+}
+
+// enumerate visits the programs of the symbol of the size built from the
+// bank, with their depths, until visit returns false.
+func (s *Synthesizer) enumerate(forest *dsl.Forest, bank *bank, symbol *dsl.Symbol, size int, example Example, rnd *rand.Rand,
+	visit func(*dsl.ProgramTree, int) bool) bool {
+	if symbol.IsTerminal() {
+		if size != 1 {
+			return true
+		}
+		values := s.filler(symbol, example)
+		if len(values) == 0 {
+			return visit(forest.Node(symbol, nil), 1)
+		}
+		for _, val := range values {
+			if !visit(forest.Node(symbol, val), 1) {
+				return false
+			}
+		}
+		return true
+	}
+
+	seqs := s.grammar.GetRhs(symbol)
+	if rnd != nil {
+		seqs = append([][]*dsl.Symbol(nil), seqs...)
+		rnd.Shuffle(len(seqs), func(i, j int) { seqs[i], seqs[j] = seqs[j], seqs[i] })
+	}
+	for _, seq := range seqs {
+		if len(seq) == 0 {
+			if size == 1 && !visit(forest.Node(symbol, nil), 1) {
+				return false
+			}
+			continue
+		}
+		children := make([]*dsl.ProgramTree, len(seq))
+		var fill func(i, rest, depth int) bool
+		fill = func(i, rest, depth int) bool {
+			if i == len(seq) {
+				return visit(forest.Node(symbol, nil, children...), depth+1)
+			}
+			// leave at least one for each of the children after, and the
+			// rest for the last one
+			lo, hi := 1, rest-(len(seq)-i-1)
+			if i == len(seq)-1 {
+				lo = rest
+			}
+			for n := lo; n <= hi; n++ {
+				for _, c := range bank.get(seq[i], n) {
+					children[i] = c
+					d := depth
+					if bank.depths[c] > d {
+						d = bank.depths[c]
+					}
+					if !fill(i+1, rest-n, d) {
+						return false
+					}
+				}
+			}
+			return true
+		}
+		if !fill(0, size-1, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// outputs evaluates the program on every example, and returns nil outputs
+// if an evaluation has no value.
+func (s *Synthesizer) outputs(ctx context.Context, pgm *dsl.ProgramTree, examples *ExampleSet) ([]interface{}, error) {
+	program := s.evaluator.Compile(pgm)
+	outputs := make([]interface{}, examples.Len())
+	for i, example := range examples.Examples() {
+		env := dsl.NewEnv(example.GetInputs()...)
+		if s.cache != nil {
+			env = env.WithCache(s.cache)
+		}
+		result := program.RunContext(ctx, env, s.limits)
+		if err := result.Err(); err != nil {
+			return nil, err
+		}
+		val, ok := result.Value()
+		if !ok {
+			return nil, nil
+		}
+		outputs[i] = val
+	}
+	return outputs, nil
+}
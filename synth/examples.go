@@ -0,0 +1,68 @@
+package synth
+
+// ExampleSet is the examples a program must satisfy all of. A search
+// checks the candidates on the examples rejecting the most candidates of
+// that search first, without reordering the set.
+type ExampleSet struct {
+	examples []Example
+}
+
+func NewExampleSet(examples ...Example) *ExampleSet {
+	set := &ExampleSet{}
+	for _, ex := range examples {
+		set.Add(ex)
+	}
+	return set
+}
+
+func (s *ExampleSet) Add(example Example) {
+	s.examples = append(s.examples, example)
+}
+
+func (s *ExampleSet) Len() int {
+	return len(s.examples)
+}
+
+// Get returns the i-th example in the order they were added.
+func (s *ExampleSet) Get(i int) Example {
+	return s.examples[i]
+}
+
+func (s *ExampleSet) Examples() []Example {
+	return s.examples
+}
+
+// ranking orders the examples of a search by how often they reject
+// candidates, so that a wrong candidate is rejected by the first ones
+// checked.
+type ranking struct {
+	// rejections counts the candidates rejected by each example
+	rejections []int
+	// order is the indices of the examples, most rejecting first
+	order []int
+}
+
+func newRanking(n int) *ranking {
+	r := &ranking{
+		rejections: make([]int, n),
+		order:      make([]int, n),
+	}
+	for i := range r.order {
+		r.order[i] = i
+	}
+	return r
+}
+
+// reject counts the rejection by the i-th example, moving it ahead of the
+// examples rejecting less.
+func (r *ranking) reject(i int) {
+	r.rejections[i]++
+	p := 0
+	for r.order[p] != i {
+		p++
+	}
+	for p > 0 && r.rejections[r.order[p-1]] < r.rejections[i] {
+		r.order[p-1], r.order[p] = r.order[p], r.order[p-1]
+		p--
+	}
+}
@@ -0,0 +1,30 @@
+package synth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRanking_reject(t *testing.T) {
+	tests := []struct {
+		name      string
+		rejects   []int
+		wantOrder []int
+	}{
+		{name: "none", rejects: nil, wantOrder: []int{0, 1, 2}},
+		{name: "last", rejects: []int{2}, wantOrder: []int{2, 0, 1}},
+		{name: "ties keep order", rejects: []int{2, 1}, wantOrder: []int{2, 1, 0}},
+		{name: "most rejecting", rejects: []int{2, 1, 1}, wantOrder: []int{1, 2, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRanking(3)
+			for _, i := range tt.rejects {
+				r.reject(i)
+			}
+			if !reflect.DeepEqual(r.order, tt.wantOrder) {
+				t.Errorf("ranking.order = %v, want %v", r.order, tt.wantOrder)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package synth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+// Strategy is the order a search enumerates programs in.
+type Strategy int
+
+const (
+	// TopDown expands the holes of sketches from the start symbol breadth
+	// first.
+	TopDown Strategy = iota
+	// BottomUp builds programs by increasing size from the terminals, and
+	// keeps one program of each symbol per distinct outputs on the examples.
+	BottomUp
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case TopDown:
+		return "top-down"
+	case BottomUp:
+		return "bottom-up"
+	}
+	return fmt.Sprintf("Strategy(%d)", int(s))
+}
+
+// Options bounds a search, where zero means unbounded.
+type Options struct {
+	Strategy Strategy
+	// MaxCandidates is the number of sketches taken from the worklist, or
+	// of the programs built bottom-up.
+	MaxCandidates int
+	// MaxDepth, MaxSize and MaxHoles bound the sketches, and the ones
+	// exceeding them are not explored.
+	MaxDepth int
+	MaxSize  int
+	MaxHoles int
+	Timeout  time.Duration
+	// MaxSketches is the number of sketches the search has seen, which it
+	// remembers to skip the duplicates, over which sketches are no longer
+	// expanded, or of the programs kept bottom-up. It bounds the memory of
+	// the search.
+	MaxSketches int
+	// Seed shuffles the order the rules of a symbol are tried in, which is
+	// the order of the grammar if zero. The same seed gives the same search.
+	Seed int64
+}
+
+// DefaultOptions caps the stored sketches at a million.
+func DefaultOptions() Options {
+	return Options{
+		MaxSketches: 1000000,
+	}
+}
+
+// Bound is a set of the bounds of Options.
+type Bound int
+
+const (
+	CandidateBound Bound = 1 << iota
+	DepthBound
+	SizeBound
+	HolesBound
+	TimeBound
+	SketchBound
+)
+
+var boundNames = []string{"candidates", "depth", "size", "holes", "time", "sketches"}
+
+func (b Bound) Has(bound Bound) bool {
+	return b&bound != 0
+}
+
+func (b Bound) String() string {
+	if b == 0 {
+		return "none"
+	}
+	names := make([]string, 0)
+	for i, name := range boundNames {
+		if b.Has(1 << i) {
+			names = append(names, name)
+		}
+	}
+	if rest := b &^ (1<<len(boundNames) - 1); rest != 0 {
+		names = append(names, fmt.Sprintf("Bound(%d)", int(rest)))
+	}
+	return strings.Join(names, "|")
+}
+
+// exceeded returns the bounds the sketch exceeds.
+func (o Options) exceeded(pgm *dsl.ProgramTree) Bound {
+	var b Bound
+	if o.MaxDepth > 0 && pgm.Depth() > o.MaxDepth {
+		b |= DepthBound
+	}
+	if o.MaxSize > 0 && pgm.Size() > o.MaxSize {
+		b |= SizeBound
+	}
+	if o.MaxHoles > 0 && pgm.Holes() > o.MaxHoles {
+		b |= HolesBound
+	}
+	return b
+}
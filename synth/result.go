@@ -0,0 +1,126 @@
+package synth
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+// StopReason tells why the search stopped.
+type StopReason int
+
+const (
+	// Solved is the search finding a program consistent with the example.
+	Solved StopReason = iota
+	// Exhausted is the search running out of candidates.
+	Exhausted
+	// LimitReached is the search stopped, or cut short of some candidates,
+	// by the bounds of the options.
+	LimitReached
+	// Stopped is the search stopped by the context.
+	Stopped
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case Solved:
+		return "solved"
+	case Exhausted:
+		return "exhausted"
+	case LimitReached:
+		return "limit reached"
+	case Stopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("StopReason(%d)", int(r))
+}
+
+// Result is the outcome of a search, where Program is nil unless the
+// search is solved.
+type Result struct {
+	Program *dsl.ProgramTree
+	// NearMiss is the first candidate satisfying the most examples but not
+	// all, if any, and Satisfied the number of examples it satisfies, or
+	// all of them for the solution.
+	NearMiss  *dsl.ProgramTree
+	Satisfied int
+	// Explored is the number of sketches taken from the worklist, or of the
+	// programs built bottom-up.
+	Explored int
+	Elapsed  time.Duration
+	Reason   StopReason
+	// Hit is the bounds the search hit.
+	Hit Bound
+	// Strategy is the strategy of the search, which tells what Explored
+	// counts.
+	Strategy Strategy
+}
+
+func (r Result) Solved() bool {
+	return r.Reason == Solved
+}
+
+func (r Result) String() string {
+	explored := "sketches"
+	if r.Strategy == BottomUp {
+		explored = "programs"
+	}
+	if r.Program != nil {
+		return fmt.Sprintf("%s after %d %s in %v: %s", r.Reason, r.Explored, explored, r.Elapsed, r.Program)
+	}
+	str := r.Reason.String()
+	if r.Hit != 0 {
+		str += " (" + r.Hit.String() + ")"
+	}
+	str += fmt.Sprintf(" after %d %s in %v", r.Explored, explored, r.Elapsed)
+	if r.NearMiss != nil {
+		str += fmt.Sprintf(", near miss satisfying %d examples: %s", r.Satisfied, r.NearMiss)
+	}
+	return str
+}
+
+// Observer is notified of the progress of a search.
+type Observer interface {
+	// Solution is called with the program found and its outputs on the
+	// examples.
+	Solution(pgm *dsl.ProgramTree, examples *ExampleSet, outputs []interface{})
+	// Done is called with the result when the search stops.
+	Done(result Result)
+}
+
+// Logger is the Observer writing the solution and the number of explored
+// sketches or programs to the writer.
+type Logger struct {
+	w io.Writer
+}
+
+func NewLogger(w io.Writer) *Logger {
+	return &Logger{
+		w: w,
+	}
+}
+
+func (l *Logger) Solution(pgm *dsl.ProgramTree, examples *ExampleSet, outputs []interface{}) {
+	fmt.Fprintln(l.w, "-----------------------")
+	fmt.Fprintln(l.w, pgm.FormattedString())
+	for i, example := range examples.Examples() {
+		fmt.Fprintln(l.w, "input  =", example.GetInputs())
+		fmt.Fprintln(l.w, "result =", outputs[i])
+	}
+}
+
+func (l *Logger) Done(result Result) {
+	switch result.Reason {
+	case Solved:
+	case LimitReached:
+		fmt.Fprintf(l.w, "Search %s (%s)\n", result.Reason, result.Hit)
+	default:
+		fmt.Fprintln(l.w, "Search", result.Reason)
+	}
+	if result.NearMiss != nil && result.Reason != Solved {
+		fmt.Fprintln(l.w, "Near miss satisfying", result.Satisfied, "examples:", result.NearMiss)
+	}
+	fmt.Fprintln(l.w, "Count  =", result.Explored)
+}
@@ -1,16 +1,39 @@
 package synth
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"math/rand"
 	"reflect"
+	"time"
 
 	"github.com/KeitaTakenouchi/grammars/dsl"
 )
 
+// Pruner tells whether a partial program may be completed to one
+// evaluating to the output, where candidates returns the values an
+// unfilled terminal can be filled with.
+type Pruner interface {
+	Feasible(pgm *dsl.ProgramTree, env dsl.Env, output interface{}, candidates func(*dsl.Symbol) []interface{}) bool
+}
+
 type Synthesizer struct {
 	grammar   dsl.Grammar
 	evaluator dsl.Evaluator
 	filler    func(*dsl.Symbol, Example) []interface{}
+	limits    dsl.Limits
+	cache     *dsl.EvalCache
+	scoping   *dsl.Scoping
+	// scopedFiller is the filler given the names in scope at the leaf,
+	// used instead of filler when set
+	scopedFiller func(*dsl.Symbol, []string, Example) []interface{}
+	pruner       Pruner
+	pruned       int
+	// rejected counts the candidates failing on the example by the kind of
+	// the error
+	rejected map[dsl.ErrorKind]int
+	observer Observer
+	options  Options
 }
 
 func NewSynthesizer(grammar dsl.Grammar, eval dsl.Evaluator, filler func(*dsl.Symbol, Example) []interface{}) Synthesizer {
@@ -18,87 +41,322 @@ func NewSynthesizer(grammar dsl.Grammar, eval dsl.Evaluator, filler func(*dsl.Sy
 		grammar:   grammar,
 		evaluator: eval,
 		filler:    filler,
+		rejected:  make(map[dsl.ErrorKind]int),
+		options:   DefaultOptions(),
 	}
 }
 
-func (s *Synthesizer) Execute(example Example) {
+// SetOptions bounds the searches, replacing DefaultOptions.
+func (s *Synthesizer) SetOptions(options Options) {
+	s.options = options
+}
+
+// SetEvalLimits bounds the evaluation of every candidate.
+func (s *Synthesizer) SetEvalLimits(limits dsl.Limits) {
+	s.limits = limits
+}
+
+// SetCache memoizes the evaluation of the subtrees shared by candidates,
+// for the evaluator with pure semantics.
+func (s *Synthesizer) SetCache(cache *dsl.EvalCache) {
+	s.cache = cache
+}
+
+// SetScoping names the binders of the scoping in the candidates, and
+// SetScopedFiller fills the leaves given the names in scope there, like
+// variable references with only the bound variables.
+func (s *Synthesizer) SetScoping(scoping *dsl.Scoping) {
+	s.scoping = scoping
+}
+
+func (s *Synthesizer) SetScopedFiller(filler func(*dsl.Symbol, []string, Example) []interface{}) {
+	s.scopedFiller = filler
+}
+
+// SetPruner discards the sketches the pruner finds infeasible before
+// filling or expanding them.
+func (s *Synthesizer) SetPruner(pruner Pruner) {
+	s.pruner = pruner
+}
+
+// SetObserver notifies the observer of the solution and the result of
+// every search.
+func (s *Synthesizer) SetObserver(observer Observer) {
+	s.observer = observer
+}
+
+func (s *Synthesizer) Pruned() int {
+	return s.pruned
+}
+
+func (s *Synthesizer) Rejected() map[dsl.ErrorKind]int {
+	return s.rejected
+}
+
+func (s *Synthesizer) Execute(example Example) (Result, error) {
+	return s.ExecuteContext(context.Background(), example)
+}
+
+func (s *Synthesizer) ExecuteContext(ctx context.Context, example Example) (Result, error) {
+	return s.ExecuteExamplesContext(ctx, NewExampleSet(example))
+}
+
+// ExecuteExamples searches for a program satisfying every example, where
+// the fillers are given the first example added to the set.
+func (s *Synthesizer) ExecuteExamples(examples *ExampleSet) (Result, error) {
+	return s.ExecuteExamplesContext(context.Background(), examples)
+}
+
+// ExecuteExamplesContext stops the search when the context is done, with
+// the error of the context, or when the timeout of the options is over,
+// with the LimitReached result.
+func (s *Synthesizer) ExecuteExamplesContext(ctx context.Context, examples *ExampleSet) (Result, error) {
+	if examples.Len() == 0 {
+		return Result{}, errors.New("synth: no examples")
+	}
+	begin := time.Now()
+	searchCtx := ctx
+	if s.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = context.WithTimeout(ctx, s.options.Timeout)
+		defer cancel()
+	}
+	var result Result
+	var err error
+	if s.options.Strategy == BottomUp {
+		result, err = s.searchBottomUp(searchCtx, examples)
+	} else {
+		result, err = s.search(searchCtx, examples)
+	}
+	if err != nil && searchCtx.Err() != nil && ctx.Err() == nil {
+		result.Reason = LimitReached
+		result.Hit |= TimeBound
+		err = nil
+	}
+	result.Elapsed = time.Since(begin)
+	result.Strategy = s.options.Strategy
+	if s.observer != nil {
+		s.observer.Done(result)
+	}
+	return result, err
+}
+
+func (s *Synthesizer) search(ctx context.Context, examples *ExampleSet) (Result, error) {
+	opts := s.options
+	var rnd *rand.Rand
+	if opts.Seed != 0 {
+		rnd = rand.New(rand.NewSource(opts.Seed))
+	}
+
+	forest := dsl.NewForest()
 	worklist := make([]*dsl.ProgramTree, 0)
-	start := dsl.NewProgramTree(s.grammar.GetStart())
+	start := forest.Node(s.grammar.GetStart(), nil)
 	worklist = append(worklist, start)
+	// the same sketch is reached by expanding its holes in any order, and
+	// hash-consing makes equal sketches the same pointer
+	seen := map[*dsl.ProgramTree]struct{}{start: struct{}{}}
+	ranking := newRanking(examples.Len())
 
-	iterLim := 1000000
-	index, maxIndex := 0, 0
-	for index <= maxIndex {
-		target := worklist[index]
-		worklist[index] = nil
+	var hit Bound
+	// index is the number of sketches taken from the worklist
+	index := 0
+	// the candidate satisfying the most examples but not all
+	var nearMiss *dsl.ProgramTree
+	satisfied := 0
+	result := func(reason StopReason) Result {
+		return Result{NearMiss: nearMiss, Satisfied: satisfied, Explored: index, Reason: reason, Hit: hit}
+	}
+	for len(worklist) > 0 {
+		if err := ctx.Err(); err != nil {
+			return result(Stopped), err
+		}
+		if opts.MaxCandidates > 0 && index >= opts.MaxCandidates {
+			hit |= CandidateBound
+			return result(LimitReached), nil
+		}
+		// taking from the front drops the taken sketches when the worklist
+		// grows into a new array
+		target := worklist[0]
+		worklist[0] = nil
+		worklist = worklist[1:]
 		index++
 
-		nonTerminals := target.NonTerminalLeaves()
-		if len(nonTerminals) == 0 {
-			for _, completePgm := range s.fillSketch(target, example) {
-				if s.check(completePgm, example) {
-					fmt.Println("Count  =", index)
-					return
+		if !s.feasible(target, examples) {
+			s.pruned++
+			continue
+		}
+
+		if target.Holes() == 0 {
+			for _, completePgm := range s.fillSketch(target, examples.Get(0)) {
+				n := s.check(ctx, completePgm, examples, ranking, satisfied)
+				if n == examples.Len() {
+					return Result{Program: completePgm, Satisfied: n, Explored: index, Reason: Solved, Hit: hit}, nil
+				}
+				if n > satisfied {
+					nearMiss, satisfied = completePgm, n
 				}
 			}
+			continue
 		}
 
-		if maxIndex >= iterLim {
+		if opts.MaxSketches > 0 && len(seen) >= opts.MaxSketches {
+			hit |= SketchBound
 			continue
 		}
-		for i := 0; i < len(nonTerminals); i++ {
-			seqs := s.grammar.GetRhs(nonTerminals[i].Symbol)
+		for _, hole := range target.NonTerminalLeafPaths() {
+			node, _ := target.Get(hole)
+			seqs := s.grammar.GetRhs(node.Symbol)
+			if rnd != nil {
+				seqs = append([][]*dsl.Symbol(nil), seqs...)
+				rnd.Shuffle(len(seqs), func(i, j int) { seqs[i], seqs[j] = seqs[j], seqs[i] })
+			}
 			for _, seq := range seqs {
-				cpy := target.Clone()
-				node := cpy.NonTerminalLeaves()[i]
-				for _, symbol := range seq {
-					pgm := dsl.NewProgramTree(symbol)
-					node.AddChildren(pgm)
+				children := make([]*dsl.ProgramTree, len(seq))
+				for i, symbol := range seq {
+					children[i] = forest.Node(symbol, nil)
 				}
-				worklist = append(worklist, cpy)
-				maxIndex++
+				var name interface{}
+				if s.scoping != nil && s.scoping.IsBinder(node.Symbol) {
+					name = s.scoping.FreshName(target, hole)
+				}
+				expanded := forest.Node(node.Symbol, name, children...)
+				pgm := forest.Replace(target, hole, expanded)
+				if _, ok := seen[pgm]; ok {
+					continue
+				}
+				seen[pgm] = struct{}{}
+				if bound := opts.exceeded(pgm); bound != 0 {
+					hit |= bound
+					continue
+				}
+				worklist = append(worklist, pgm)
 			}
 		}
 	}
+	// the last candidates may not be checked
+	if err := ctx.Err(); err != nil {
+		return result(Stopped), err
+	}
+	if hit != 0 {
+		return result(LimitReached), nil
+	}
+	return result(Exhausted), nil
+}
 
+// feasible reports whether the pruner finds the sketch feasible on every
+// example.
+func (s *Synthesizer) feasible(pgm *dsl.ProgramTree, examples *ExampleSet) bool {
+	if s.pruner == nil {
+		return true
+	}
+	for _, example := range examples.Examples() {
+		env := dsl.NewEnv(example.GetInputs()...)
+		// the scoped filler is given no names, so that the variables are Top
+		candidates := func(symbol *dsl.Symbol) []interface{} {
+			if s.scopedFiller != nil {
+				return s.scopedFiller(symbol, nil, example)
+			}
+			return s.filler(symbol, example)
+		}
+		if !s.pruner.Feasible(pgm, env, example.GetOutput(), candidates) {
+			return false
+		}
+	}
+	return true
 }
 
+// fillSketch returns the programs filling the leaves of the sketch. They are
+// built in a scratch forest, so that the forest of the search keeps only the
+// sketches and not every program tried.
 func (s *Synthesizer) fillSketch(pgm *dsl.ProgramTree, example Example) []*dsl.ProgramTree {
 	valuesList := make([][]interface{}, 0)
-	indexesOfHoles := make([]int, 0)
-	for i, leaf := range pgm.Leaves() {
-		values := s.filler(leaf.Symbol, example)
+	holes := make([]dsl.Path, 0)
+	for _, path := range pgm.LeafPaths() {
+		leaf, _ := pgm.Get(path)
+		var values []interface{}
+		if s.scopedFiller != nil {
+			var scope []string
+			if s.scoping != nil {
+				scope = s.scoping.Scope(pgm, path)
+			}
+			values = s.scopedFiller(leaf.Symbol, scope, example)
+		} else {
+			values = s.filler(leaf.Symbol, example)
+		}
 		if len(values) > 0 {
 			valuesList = append(valuesList, values)
-			indexesOfHoles = append(indexesOfHoles, i)
+			holes = append(holes, path)
 		}
 	}
 
+	scratch := dsl.NewForest()
 	var ret []*dsl.ProgramTree
 	for _, valueComb := range cartesianProduct(valuesList) {
-		clone := pgm.Clone()
-		for i, indexOfHole := range indexesOfHoles {
-			clone.Leaves()[indexOfHole].With(valueComb[i])
+		filled := pgm
+		for i, hole := range holes {
+			leaf, _ := pgm.Get(hole)
+			filled = scratch.Replace(filled, hole, scratch.Node(leaf.Symbol, valueComb[i]))
 		}
-		ret = append(ret, clone)
+		ret = append(ret, filled)
 	}
 	return ret
 }
 
-func (s *Synthesizer) check(pgm *dsl.ProgramTree, example Example) bool {
-	env := dsl.NewEnv()
-	env.AddArgs(example.GetInputs()...)
-	result := s.evaluator.Eval(pgm, env)
-	res, _ := result.Value()
+// check returns the number of examples the program satisfies, checking
+// the most rejecting examples of the ranking first. A rejected program is
+// checked on the rest only while it may satisfy more than best examples. An
+// evaluation canceled by the context stops the check without a rejection.
+func (s *Synthesizer) check(ctx context.Context, pgm *dsl.ProgramTree, examples *ExampleSet, ranking *ranking, best int) int {
+	program := s.evaluator.Compile(pgm)
+	outputs := make([]interface{}, examples.Len())
+	satisfied, rejected := 0, false
+	// rejecting reorders the examples
+	order := append([]int(nil), ranking.order...)
+	for n, i := range order {
+		if rejected && satisfied+len(order)-n <= best {
+			return satisfied
+		}
+		example := examples.Get(i)
+		env := dsl.NewEnv(example.GetInputs()...)
+		if s.cache != nil {
+			env = env.WithCache(s.cache)
+		}
+		result := program.RunContext(ctx, env, s.limits)
+		if dsl.IsKind(result.Err(), dsl.Canceled) {
+			return satisfied
+		}
+		res, _ := result.Value()
+		if result.Err() == nil && reflect.DeepEqual(res, example.GetOutput()) {
+			outputs[i] = res
+			satisfied++
+			continue
+		}
+		if rejected {
+			continue
+		}
+		rejected = true
+		ranking.reject(i)
+		// a program failing on the example is rejected like a wrong one
+		s.reject(result.Err())
+	}
+	if !rejected && s.observer != nil {
+		s.observer.Solution(pgm, examples, outputs)
+	}
+	return satisfied
+}
 
-	if reflect.DeepEqual(res, example.GetOutput()) {
-		fmt.Println("-----------------------")
-		fmt.Println(pgm.FormattedString())
-		fmt.Println("intput =", example.GetInputs())
-		fmt.Println("result =", result)
-		return true
+// reject counts the candidate failing with the error by its kind, unless
+// the error is nil or the evaluation is canceled.
+func (s *Synthesizer) reject(err error) {
+	if err == nil || dsl.IsKind(err, dsl.Canceled) {
+		return
+	}
+	var evalErr *dsl.EvalError
+	if errors.As(err, &evalErr) {
+		s.rejected[evalErr.Kind]++
+	} else {
+		s.rejected[dsl.Failure]++
 	}
-	return false
 }
 
 func cartesianProduct(lists [][]interface{}) [][]interface{} {
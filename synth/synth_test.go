@@ -1,8 +1,15 @@
 package synth
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
 )
 
 func Test_cartesianProduct(t *testing.T) {
@@ -97,3 +104,591 @@ func Test_cartesianProduct(t *testing.T) {
 		})
 	}
 }
+
+func TestSynthesizer_fillSketch_Scoped(t *testing.T) {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	let := dsl.NewSymbol("let")
+	plus := dsl.NewSymbol("add")
+	v := dsl.NewSymbol("var")
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, exp)
+	gram.AddRule(exp, let)
+	gram.AddRule(exp, plus)
+	gram.AddRule(exp, v)
+	gram.AddRule(let, exp, exp)
+	gram.AddRule(plus, exp, exp)
+
+	s := NewSynthesizer(gram, dsl.Evaluator{}, nil)
+	s.SetScoping(dsl.NewScoping().Bind(let, 1))
+	s.SetScopedFiller(func(symbol *dsl.Symbol, scope []string, example Example) []interface{} {
+		var ret []interface{}
+		if symbol == v {
+			for _, name := range scope {
+				ret = append(ret, name)
+			}
+		}
+		return ret
+	})
+
+	// let v0 = _ in let v1 = _ in _ + _
+	forest := dsl.NewForest()
+	variable := forest.Node(exp, nil, forest.Node(v, nil))
+	body := forest.Node(exp, nil, forest.Node(plus, nil, variable, variable))
+	inner := forest.Node(exp, nil, forest.Node(let, "v1", variable, body))
+	sketch := forest.Node(S, nil, forest.Node(exp, nil, forest.Node(let, "v0", variable, inner)))
+
+	got := make([]string, 0)
+	for _, pgm := range s.fillSketch(sketch, NewExample(0)) {
+		names := make([]string, 0)
+		for _, leaf := range pgm.Leaves() {
+			name, ok := leaf.Value()
+			if !ok {
+				name = "_"
+			}
+			names = append(names, name.(string))
+		}
+		got = append(got, strings.Join(names, " "))
+	}
+	sort.Strings(got)
+	// nothing is in scope in the bound expression of v0
+	want := []string{"_ v0 v0 v0", "_ v0 v0 v1", "_ v0 v1 v0", "_ v0 v1 v1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Synthesizer.fillSketch() = %v, want %v", got, want)
+	}
+}
+
+// newNegSynthesizer returns the synthesizer of the programs negating
+// constants 1 and 2 or the parameters, or returning them.
+func newNegSynthesizer() Synthesizer {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	neg := dsl.NewSymbol("neg")
+	cnst := dsl.NewSymbol("const")
+	param := dsl.NewSymbol("param")
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, exp)
+	gram.AddRule(exp, neg)
+	gram.AddRule(exp, cnst)
+	gram.AddRule(exp, param)
+	gram.AddRule(neg, cnst)
+	gram.AddRule(neg, param)
+
+	evaluator := dsl.NewSemantics(&gram).
+		Register(neg, dsl.Unary(func(v int) int { return -v })).
+		RegisterLeaf(cnst, dsl.Constant).
+		RegisterLeaf(param, dsl.Argument).
+		Evaluator()
+	filler := func(symbol *dsl.Symbol, example Example) []interface{} {
+		var ret []interface{}
+		switch symbol {
+		case cnst:
+			ret = append(ret, 1, 2)
+		case param:
+			for i := 0; i < example.GetInputCount(); i++ {
+				ret = append(ret, i)
+			}
+		}
+		return ret
+	}
+	return NewSynthesizer(gram, evaluator, filler)
+}
+
+func TestSynthesizer_Execute(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		output      interface{}
+		wantReason  StopReason
+		wantProgram string
+		wantErr     error
+	}{
+		{name: "solved", ctx: context.Background(), output: -2, wantReason: Solved, wantProgram: `S[exp[neg["const"(2)]]]`},
+		{name: "exhausted", ctx: context.Background(), output: 3, wantReason: Exhausted},
+		{name: "stopped", ctx: canceled, output: 1, wantReason: Stopped, wantErr: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNegSynthesizer()
+			var done []Result
+			s.SetObserver(observerFunc(func(r Result) { done = append(done, r) }))
+
+			got, err := s.ExecuteContext(tt.ctx, NewExample(tt.output))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Synthesizer.ExecuteContext() error = %v, want %v", err, tt.wantErr)
+			}
+			if got.Reason != tt.wantReason {
+				t.Errorf("Synthesizer.ExecuteContext() reason = %v, want %v", got.Reason, tt.wantReason)
+			}
+			var gotProgram string
+			if got.Program != nil {
+				gotProgram = got.Program.String()
+			}
+			if gotProgram != tt.wantProgram {
+				t.Errorf("Synthesizer.ExecuteContext() program = %v, want %v", gotProgram, tt.wantProgram)
+			}
+			if len(done) != 1 || done[0] != got {
+				t.Errorf("Observer.Done() got %v, want [%v]", done, got)
+			}
+		})
+	}
+}
+
+func TestSynthesizer_Execute_Canceled(t *testing.T) {
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		t.Run(strategy.String(), func(t *testing.T) {
+			S := dsl.NewSymbol("S")
+			cnst := dsl.NewSymbol("const")
+			gram := dsl.NewGrammar(S)
+			gram.AddRule(S, cnst)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			// the first candidate cancels the search, so that the next
+			// ones are canceled when evaluated
+			evaluator := dsl.NewEvaluator(func(n *dsl.ProgramTree, env dsl.Env) dsl.EvalResult {
+				cancel()
+				for len(n.Children) > 0 {
+					n = n.Children[0]
+				}
+				val, _ := n.Value()
+				return dsl.NewEvalResult(val)
+			})
+			filler := func(symbol *dsl.Symbol, example Example) []interface{} {
+				return []interface{}{1, 2, 3}
+			}
+			s := NewSynthesizer(gram, evaluator, filler)
+			s.SetOptions(Options{Strategy: strategy})
+
+			examples := NewExampleSet(NewExample(9), NewExample(8))
+			got, err := s.ExecuteExamplesContext(ctx, examples)
+			if !errors.Is(err, context.Canceled) || got.Reason != Stopped {
+				t.Fatalf("Synthesizer.ExecuteExamplesContext() = %v, %v, want %v, %v", got.Reason, err, Stopped, context.Canceled)
+			}
+			if n := s.Rejected()[dsl.Canceled]; n != 0 {
+				t.Errorf("Synthesizer.Rejected() counts %d canceled candidates, want 0", n)
+			}
+		})
+	}
+}
+
+func TestSynthesizer_ExecuteExamples(t *testing.T) {
+	tests := []struct {
+		name          string
+		examples      *ExampleSet
+		wantReason    StopReason
+		wantProgram   string
+		wantNearMiss  string
+		wantSatisfied int
+	}{
+		{
+			name:          "one example",
+			examples:      NewExampleSet(NewExample(-1, 1)),
+			wantReason:    Solved,
+			wantProgram:   `S[exp[neg["const"(1)]]]`,
+			wantSatisfied: 1,
+		},
+		{
+			name:          "all examples",
+			examples:      NewExampleSet(NewExample(-1, 1), NewExample(-2, 2)),
+			wantReason:    Solved,
+			wantProgram:   `S[exp[neg["param"(0)]]]`,
+			wantSatisfied: 2,
+		},
+		{
+			name:          "near miss",
+			examples:      NewExampleSet(NewExample(-1, 1), NewExample(5, 2), NewExample(-1, 3)),
+			wantReason:    Exhausted,
+			wantNearMiss:  `S[exp[neg["const"(1)]]]`,
+			wantSatisfied: 2,
+		},
+		{
+			name:          "no near miss",
+			examples:      NewExampleSet(NewExample(7, 1), NewExample(8, 2)),
+			wantReason:    Exhausted,
+			wantSatisfied: 0,
+		},
+	}
+	str := func(t *dsl.ProgramTree) string {
+		if t == nil {
+			return ""
+		}
+		return t.String()
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNegSynthesizer()
+			got, err := s.ExecuteExamples(tt.examples)
+			if err != nil {
+				t.Fatalf("Synthesizer.ExecuteExamples() error = %v", err)
+			}
+			if got.Reason != tt.wantReason {
+				t.Errorf("Synthesizer.ExecuteExamples() reason = %v, want %v", got.Reason, tt.wantReason)
+			}
+			if str(got.Program) != tt.wantProgram {
+				t.Errorf("Synthesizer.ExecuteExamples() program = %v, want %v", str(got.Program), tt.wantProgram)
+			}
+			if str(got.NearMiss) != tt.wantNearMiss || got.Satisfied != tt.wantSatisfied {
+				t.Errorf("Synthesizer.ExecuteExamples() near miss = %v satisfying %d, want %v satisfying %d",
+					str(got.NearMiss), got.Satisfied, tt.wantNearMiss, tt.wantSatisfied)
+			}
+		})
+	}
+
+	s := newNegSynthesizer()
+	if _, err := s.ExecuteExamples(NewExampleSet()); err == nil {
+		t.Errorf("Synthesizer.ExecuteExamples() with no examples error = nil")
+	}
+}
+
+func TestSynthesizer_Execute_Options(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    Options
+		output     interface{}
+		wantReason StopReason
+		wantHit    Bound
+	}{
+		{name: "default", options: DefaultOptions(), output: -2, wantReason: Solved},
+		{name: "candidates", options: Options{MaxCandidates: 2}, output: -2, wantReason: LimitReached, wantHit: CandidateBound},
+		{name: "depth", options: Options{MaxDepth: 3}, output: -2, wantReason: LimitReached, wantHit: DepthBound},
+		{name: "size", options: Options{MaxSize: 3}, output: -2, wantReason: LimitReached, wantHit: SizeBound},
+		{name: "within bounds", options: Options{MaxDepth: 4, MaxSize: 4, MaxHoles: 1}, output: -2, wantReason: Solved},
+		{name: "sketches", options: Options{MaxSketches: 1}, output: -2, wantReason: LimitReached, wantHit: SketchBound},
+		{name: "exhausted within bounds", options: Options{MaxDepth: 4}, output: 3, wantReason: Exhausted},
+		{name: "seed", options: Options{Seed: 42}, output: -1, wantReason: Solved},
+		{name: "seed bottom-up", options: Options{Strategy: BottomUp, Seed: 42}, output: -1, wantReason: Solved},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execute := func() Result {
+				s := newNegSynthesizer()
+				s.SetOptions(tt.options)
+				got, err := s.Execute(NewExample(tt.output))
+				if err != nil {
+					t.Fatalf("Synthesizer.Execute() error = %v", err)
+				}
+				return got
+			}
+			got := execute()
+			if got.Reason != tt.wantReason || got.Hit != tt.wantHit {
+				t.Errorf("Synthesizer.Execute() = %v (%v), want %v (%v)", got.Reason, got.Hit, tt.wantReason, tt.wantHit)
+			}
+			// the same options give the same search
+			again := execute()
+			if fmt.Sprint(again.Program) != fmt.Sprint(got.Program) || again.Explored != got.Explored {
+				t.Errorf("Synthesizer.Execute() = %v after %d, then %v after %d",
+					got.Program, got.Explored, again.Program, again.Explored)
+			}
+		})
+	}
+}
+
+func TestSynthesizer_Execute_BottomUp(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      Options
+		examples     *ExampleSet
+		wantReason   StopReason
+		wantHit      Bound
+		wantProgram  string
+		wantExplored int
+	}{
+		{
+			name:        "solved",
+			examples:    NewExampleSet(NewExample(-1, 1), NewExample(-2, 2)),
+			wantReason:  Solved,
+			wantProgram: `S[exp[neg["param"(0)]]]`,
+		},
+		{
+			// the programs of a symbol with the outputs of another are
+			// dropped, like exp[param(0)] after exp[const(1)]
+			name:         "exhausted",
+			examples:     NewExampleSet(NewExample(7, 1)),
+			wantReason:   Exhausted,
+			wantExplored: 15,
+		},
+		{
+			name:         "size",
+			options:      Options{MaxSize: 3},
+			examples:     NewExampleSet(NewExample(-1, 1)),
+			wantReason:   LimitReached,
+			wantHit:      SizeBound,
+			wantExplored: 13,
+		},
+		{
+			name:         "candidates",
+			options:      Options{MaxCandidates: 3},
+			examples:     NewExampleSet(NewExample(-1, 1)),
+			wantReason:   LimitReached,
+			wantHit:      CandidateBound,
+			wantExplored: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newNegSynthesizer()
+			tt.options.Strategy = BottomUp
+			s.SetOptions(tt.options)
+			got, err := s.ExecuteExamples(tt.examples)
+			if err != nil {
+				t.Fatalf("Synthesizer.ExecuteExamples() error = %v", err)
+			}
+			if got.Reason != tt.wantReason || got.Hit != tt.wantHit {
+				t.Errorf("Synthesizer.ExecuteExamples() = %v (%v), want %v (%v)", got.Reason, got.Hit, tt.wantReason, tt.wantHit)
+			}
+			if got.Program != nil && got.Program.String() != tt.wantProgram {
+				t.Errorf("Synthesizer.ExecuteExamples() program = %v, want %v", got.Program, tt.wantProgram)
+			}
+			if tt.wantExplored != 0 && got.Explored != tt.wantExplored {
+				t.Errorf("Synthesizer.ExecuteExamples() explored = %v, want %v", got.Explored, tt.wantExplored)
+			}
+		})
+	}
+
+	s := newNegSynthesizer()
+	s.SetOptions(Options{Strategy: BottomUp})
+	s.SetScoping(dsl.NewScoping())
+	if _, err := s.Execute(NewExample(1)); err == nil {
+		t.Errorf("Synthesizer.Execute() with scoping error = nil")
+	}
+}
+
+func TestSynthesizer_Execute_BottomUp_Syntax(t *testing.T) {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	bin := dsl.NewSymbol("bin")
+	op := dsl.NewSymbol("op")
+	param := dsl.NewSymbol("param")
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, exp)
+	gram.AddRule(exp, bin)
+	gram.AddRule(exp, param)
+	gram.AddRule(bin, exp, op, exp)
+
+	// op has no semantics, and bin reads its value as syntax
+	evaluator := dsl.NewSemantics(&gram).
+		RegisterLeaf(param, dsl.Argument).
+		RegisterForm(bin, func(node *dsl.ProgramTree, env dsl.Env, eval func(int, dsl.Env) dsl.EvalResult) dsl.EvalResult {
+			a, ok := eval(0, env).Value()
+			b, ok2 := eval(2, env).Value()
+			if !ok || !ok2 {
+				return dsl.NewEvalResult(nil)
+			}
+			if name, _ := node.Children[1].Value(); name == "-" {
+				return dsl.NewEvalResult(a.(int) - b.(int))
+			}
+			return dsl.NewEvalResult(a.(int) + b.(int))
+		}).
+		Evaluator()
+	filler := func(symbol *dsl.Symbol, example Example) []interface{} {
+		switch symbol {
+		case op:
+			return []interface{}{"+", "-"}
+		case param:
+			return []interface{}{0, 1}
+		}
+		return nil
+	}
+	s := NewSynthesizer(gram, evaluator, filler)
+	s.SetOptions(Options{Strategy: BottomUp})
+	got, err := s.ExecuteExamples(NewExampleSet(NewExample(2, 5, 3), NewExample(-1, 1, 2)))
+	if err != nil {
+		t.Fatalf("Synthesizer.ExecuteExamples() error = %v", err)
+	}
+	want := `S[exp[bin[exp["param"(0)],"op"(-),exp["param"(1)]]]]`
+	if got.Program == nil || got.Program.String() != want {
+		t.Errorf("Synthesizer.ExecuteExamples() = %v, want %v", got, want)
+	}
+	if n := s.Rejected()[dsl.Failure]; n != 0 {
+		t.Errorf("Synthesizer.Rejected() counts %d failures of the syntax, want 0", n)
+	}
+}
+
+func TestSynthesizer_Execute_BottomUp_NumericTypes(t *testing.T) {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	cnst := dsl.NewSymbol("const")
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, exp)
+	gram.AddRule(exp, cnst)
+
+	evaluator := dsl.NewSemantics(&gram).
+		RegisterLeaf(cnst, dsl.Constant).
+		Evaluator()
+	// 1 and 1.0 print alike but are different outputs
+	filler := func(symbol *dsl.Symbol, example Example) []interface{} {
+		return []interface{}{1, 1.0}
+	}
+	s := NewSynthesizer(gram, evaluator, filler)
+	s.SetOptions(Options{Strategy: BottomUp})
+	got, err := s.Execute(NewExample(1.0))
+	if err != nil {
+		t.Fatalf("Synthesizer.Execute() error = %v", err)
+	}
+	if !got.Solved() {
+		t.Errorf("Synthesizer.Execute() = %v, want solved", got)
+	}
+}
+
+func TestSynthesizer_Execute_SharedCache(t *testing.T) {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	plus := dsl.NewSymbol("add")
+	param := dsl.NewSymbol("param")
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, exp)
+	gram.AddRule(exp, plus)
+	gram.AddRule(exp, param)
+	gram.AddRule(plus, exp, exp)
+
+	evaluator := dsl.NewSemantics(&gram).
+		Register(plus, dsl.Binary(func(a, b int) int { return a + b })).
+		RegisterLeaf(param, dsl.Argument).
+		MarkPure().
+		Evaluator()
+	filler := func(symbol *dsl.Symbol, example Example) []interface{} {
+		if symbol == param {
+			return []interface{}{0}
+		}
+		return nil
+	}
+
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		t.Run(strategy.String(), func(t *testing.T) {
+			s := NewSynthesizer(gram, evaluator, filler)
+			s.SetCache(dsl.NewEvalCache(1 << 10))
+			s.SetOptions(Options{Strategy: strategy, MaxSize: 7})
+			if got, _ := s.Execute(NewExample(3, 3)); !got.Solved() {
+				t.Fatalf("Synthesizer.Execute() = %v, want solved", got)
+			}
+			// x0 + x0 is 6 on 3, which the cache must not answer for 5
+			if got, _ := s.Execute(NewExample(6, 5)); got.Solved() {
+				t.Errorf("Synthesizer.Execute() = %v, want not solved", got)
+			}
+			if got, _ := s.Execute(NewExample(10, 5)); !got.Solved() {
+				t.Errorf("Synthesizer.Execute() = %v, want solved", got)
+			}
+		})
+	}
+}
+
+func TestSynthesizer_SetCache_PureEvaluator(t *testing.T) {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	plus := dsl.NewSymbol("add")
+	param := dsl.NewSymbol("param")
+	gram := dsl.NewGrammar(S)
+	gram.AddRule(S, exp)
+	gram.AddRule(exp, plus)
+	gram.AddRule(exp, param)
+	gram.AddRule(plus, exp, exp)
+
+	// an evaluator not built by Semantics, which only caches whole programs
+	var eval func(n *dsl.ProgramTree, env dsl.Env) int
+	eval = func(n *dsl.ProgramTree, env dsl.Env) int {
+		switch n.Symbol {
+		case param:
+			i, _ := n.Value()
+			return env.GetArg(i.(int)).(int)
+		case plus:
+			return eval(n.Children[0], env) + eval(n.Children[1], env)
+		}
+		return eval(n.Children[0], env)
+	}
+	evaluator := dsl.NewPureEvaluator(func(n *dsl.ProgramTree, env dsl.Env) dsl.EvalResult {
+		return dsl.NewEvalResult(eval(n, env))
+	})
+	filler := func(symbol *dsl.Symbol, example Example) []interface{} {
+		if symbol == param {
+			return []interface{}{0}
+		}
+		return nil
+	}
+
+	for _, strategy := range []Strategy{TopDown, BottomUp} {
+		t.Run(strategy.String(), func(t *testing.T) {
+			cache := dsl.NewEvalCache(1 << 10)
+			s := NewSynthesizer(gram, evaluator, filler)
+			s.SetCache(cache)
+			s.SetOptions(Options{Strategy: strategy})
+			// the second search checks the programs of the first again
+			for i := 0; i < 2; i++ {
+				if got, _ := s.Execute(NewExample(9, 3)); !got.Solved() {
+					t.Fatalf("Synthesizer.Execute() = %v, want solved", got)
+				}
+			}
+			if stats := cache.Stats(); stats.Hits == 0 {
+				t.Errorf("EvalCache.Stats() = %+v, want hits", stats)
+			}
+		})
+	}
+}
+
+func TestBound_String(t *testing.T) {
+	tests := []struct {
+		b    Bound
+		want string
+	}{
+		{b: 0, want: "none"},
+		{b: DepthBound, want: "depth"},
+		{b: CandidateBound | SizeBound | SketchBound, want: "candidates|size|sketches"},
+		{b: TimeBound | 1<<10, want: "time|Bound(1024)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.b.String(); got != tt.want {
+				t.Errorf("Bound.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResult_String(t *testing.T) {
+	tests := []struct {
+		name   string
+		result Result
+		want   string
+	}{
+		{
+			name:   "top-down",
+			result: Result{Explored: 3, Reason: Exhausted},
+			want:   "exhausted after 3 sketches in 0s",
+		},
+		{
+			name:   "bottom-up",
+			result: Result{Explored: 3, Reason: LimitReached, Hit: SizeBound, Strategy: BottomUp},
+			want:   "limit reached (size) after 3 programs in 0s",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.result.String(); got != tt.want {
+				t.Errorf("Result.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	s := newNegSynthesizer()
+	var buf strings.Builder
+	s.SetObserver(NewLogger(&buf))
+	if _, err := s.Execute(NewExample(-1, 1)); err != nil {
+		t.Fatalf("Synthesizer.Execute() error = %v", err)
+	}
+	for _, want := range []string{"input  = [1]\n", "result = -1\n", "Count  ="} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Logger writes %q, want %q in it", buf.String(), want)
+		}
+	}
+}
+
+type observerFunc func(Result)
+
+func (f observerFunc) Solution(*dsl.ProgramTree, *ExampleSet, []interface{}) {}
+
+func (f observerFunc) Done(r Result) { f(r) }
@@ -0,0 +1,157 @@
+package unparse
+
+import "strings"
+
+// Doc is a document of the Wadler-style pretty printer: a layout that
+// puts each group on one line if it fits the width and breaks its lines
+// otherwise.
+type Doc interface {
+	isDoc()
+}
+
+type text string
+
+type line struct {
+	flat string
+}
+
+type nest struct {
+	indent int
+	doc    Doc
+}
+
+type concat []Doc
+
+type group struct {
+	doc Doc
+}
+
+func (text) isDoc()   {}
+func (line) isDoc()   {}
+func (nest) isDoc()   {}
+func (concat) isDoc() {}
+func (group) isDoc()  {}
+
+func Text(s string) Doc {
+	return text(s)
+}
+
+// Line is a line break, or a space when its group fits on one line.
+func Line() Doc {
+	return line{flat: " "}
+}
+
+// SoftLine is a line break, or nothing when its group fits on one line.
+func SoftLine() Doc {
+	return line{flat: ""}
+}
+
+func Nest(indent int, d Doc) Doc {
+	return nest{indent, d}
+}
+
+func Concat(docs ...Doc) Doc {
+	return concat(docs)
+}
+
+func Group(d Doc) Doc {
+	return group{d}
+}
+
+func Join(sep Doc, docs []Doc) Doc {
+	ret := make(concat, 0, 2*len(docs))
+	for i, d := range docs {
+		if i > 0 {
+			ret = append(ret, sep)
+		}
+		ret = append(ret, d)
+	}
+	return ret
+}
+
+type mode int
+
+const (
+	flat mode = iota
+	broken
+)
+
+type item struct {
+	indent int
+	mode   mode
+	doc    Doc
+}
+
+// Render lays out the document within the width where possible.
+func Render(d Doc, width int) string {
+	var sb strings.Builder
+	col := 0
+	stack := []item{{0, broken, d}}
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch doc := it.doc.(type) {
+		case text:
+			sb.WriteString(string(doc))
+			col += len(doc)
+		case line:
+			if it.mode == flat {
+				sb.WriteString(doc.flat)
+				col += len(doc.flat)
+			} else {
+				sb.WriteString("\n" + strings.Repeat(" ", it.indent))
+				col = it.indent
+			}
+		case nest:
+			stack = append(stack, item{it.indent + doc.indent, it.mode, doc.doc})
+		case concat:
+			for i := len(doc) - 1; i >= 0; i-- {
+				stack = append(stack, item{it.indent, it.mode, doc[i]})
+			}
+		case group:
+			m := broken
+			if it.mode == flat || fits(width-col, item{it.indent, flat, doc.doc}, stack) {
+				m = flat
+			}
+			stack = append(stack, item{it.indent, m, doc.doc})
+		}
+	}
+	return sb.String()
+}
+
+// fits reports whether the item and the rest of the stack up to the next
+// line break in broken mode take at most the remaining width. It stops as
+// soon as the width runs out, and takes the rest from the top without
+// copying it.
+func fits(remaining int, it item, rest []item) bool {
+	items := []item{it}
+	for remaining >= 0 {
+		if len(items) == 0 {
+			if len(rest) == 0 {
+				return true
+			}
+			items = append(items, rest[len(rest)-1])
+			rest = rest[:len(rest)-1]
+		}
+		it := items[len(items)-1]
+		items = items[:len(items)-1]
+		switch doc := it.doc.(type) {
+		case text:
+			remaining -= len(doc)
+		case line:
+			if it.mode == broken {
+				return true
+			}
+			remaining -= len(doc.flat)
+		case nest:
+			items = append(items, item{it.indent + doc.indent, it.mode, doc.doc})
+		case concat:
+			for i := len(doc) - 1; i >= 0; i-- {
+				items = append(items, item{it.indent, it.mode, doc[i]})
+			}
+		case group:
+			items = append(items, item{it.indent, it.mode, doc.doc})
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package unparse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	args := Join(Concat(Text(","), Line()), []Doc{Text("alpha"), Text("beta"), Text("gamma")})
+	call := Group(Concat(Text("f("), Nest(2, Concat(SoftLine(), args)), SoftLine(), Text(")")))
+
+	tests := []struct {
+		name  string
+		doc   Doc
+		width int
+		want  string
+	}{
+		{name: "fits", doc: call, width: 80, want: "f(alpha, beta, gamma)"},
+		{name: "breaks", doc: call, width: 10, want: "f(\n  alpha,\n  beta,\n  gamma\n)"},
+		{
+			name:  "inner group stays flat",
+			doc:   Group(Concat(Text("let"), Nest(2, Concat(Line(), call)))),
+			width: 24,
+			want:  "let\n  f(alpha, beta, gamma)",
+		},
+		{name: "text only", doc: Text("abc"), width: 1, want: "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.doc, tt.width); got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender_ManyGroups(t *testing.T) {
+	n := 100000
+	groups := make([]Doc, n)
+	for i := range groups {
+		groups[i] = Group(Concat(Text("x"), SoftLine(), Text("y")))
+	}
+	doc := Group(Join(Line(), groups))
+	want := strings.TrimSuffix(strings.Repeat("xy\n", n), "\n")
+	if got := Render(doc, 80); got != want {
+		t.Errorf("Render() = %.20q..., want %.20q...", got, want)
+	}
+}
@@ -0,0 +1,239 @@
+package unparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+)
+
+type Assoc int
+
+const (
+	Left Assoc = iota
+	Right
+	NonAssoc
+)
+
+// atomPrec is the precedence of nodes that never need parentheses.
+const atomPrec = 1 << 30
+
+const DefaultWidth = 80
+
+// rule renders a node from the documents of its children.
+type rule struct {
+	prec  int
+	assoc Assoc
+	// render returns the document of the node; paren wraps the i-th child
+	// in parentheses if its precedence is too low at that position.
+	render func(n *dsl.ProgramTree, children []Doc, paren func(i int, d Doc) Doc) Doc
+}
+
+// Printer renders the program trees of a grammar in concrete syntax with
+// a rule per symbol. Nodes of symbols without a rule are rendered through
+// their only child, or as `sym(children...)` when they have more.
+type Printer struct {
+	grammar *dsl.Grammar
+	rules   map[*dsl.Symbol]rule
+	width   int
+}
+
+func New(grammar *dsl.Grammar) *Printer {
+	return &Printer{
+		grammar: grammar,
+		rules:   make(map[*dsl.Symbol]rule),
+		width:   DefaultWidth,
+	}
+}
+
+func (p *Printer) SetWidth(width int) *Printer {
+	p.width = width
+	return p
+}
+
+func (p *Printer) add(s *dsl.Symbol, r rule) *Printer {
+	if g, ok := p.grammar.GetSymbol(s.Id); !ok || g != s {
+		panic(fmt.Sprintf("unparse: symbol %s is not in the grammar", s))
+	}
+	p.rules[s] = r
+	return p
+}
+
+// Infix renders a binary node as `left op right`. Higher precedences bind
+// tighter.
+func (p *Printer) Infix(s *dsl.Symbol, op string, prec int, assoc Assoc) *Printer {
+	return p.add(s, rule{
+		prec:  prec,
+		assoc: assoc,
+		render: func(n *dsl.ProgramTree, children []Doc, paren func(int, Doc) Doc) Doc {
+			if len(children) != 2 {
+				return call(s.Id, children)
+			}
+			return Group(Concat(
+				paren(0, children[0]),
+				Text(" "+op),
+				Nest(2, Concat(Line(), paren(1, children[1]))),
+			))
+		},
+	})
+}
+
+// Prefix renders a unary node as `op operand`.
+func (p *Printer) Prefix(s *dsl.Symbol, op string, prec int) *Printer {
+	return p.add(s, rule{
+		prec:  prec,
+		assoc: Right,
+		render: func(n *dsl.ProgramTree, children []Doc, paren func(int, Doc) Doc) Doc {
+			if len(children) != 1 {
+				return call(s.Id, children)
+			}
+			return Concat(Text(op), paren(0, children[0]))
+		},
+	})
+}
+
+// Call renders a node as `name(children...)`.
+func (p *Printer) Call(s *dsl.Symbol, name string) *Printer {
+	return p.add(s, rule{
+		prec: atomPrec,
+		render: func(n *dsl.ProgramTree, children []Doc, paren func(int, Doc) Doc) Doc {
+			return call(name, children)
+		},
+	})
+}
+
+// Atom renders the value of a leaf node with format.
+func (p *Printer) Atom(s *dsl.Symbol, format func(value interface{}) string) *Printer {
+	return p.add(s, rule{
+		prec: atomPrec,
+		render: func(n *dsl.ProgramTree, children []Doc, paren func(int, Doc) Doc) Doc {
+			val, ok := n.Value()
+			if !ok {
+				return hole(n.Symbol)
+			}
+			return Text(format(val))
+		},
+	})
+}
+
+// Template renders a node from a template where `$i` is the i-th child,
+// `$v` the value of the node and a newline a line break of the group, as
+// in "SELECT $1\nFROM $0".
+func (p *Printer) Template(s *dsl.Symbol, prec int, tmpl string) *Printer {
+	return p.add(s, rule{
+		prec: prec,
+		render: func(n *dsl.ProgramTree, children []Doc, paren func(int, Doc) Doc) Doc {
+			docs := make([]Doc, 0)
+			for i, ln := range strings.Split(tmpl, "\n") {
+				if i > 0 {
+					docs = append(docs, Line())
+				}
+				docs = append(docs, expand(ln, n, children))
+			}
+			return Group(Concat(docs...))
+		},
+	})
+}
+
+func expand(tmpl string, n *dsl.ProgramTree, children []Doc) Doc {
+	docs := make([]Doc, 0)
+	for {
+		i := strings.IndexByte(tmpl, '$')
+		if i < 0 || i == len(tmpl)-1 {
+			return Concat(append(docs, Text(tmpl))...)
+		}
+		docs = append(docs, Text(tmpl[:i]))
+		rest := tmpl[i+1:]
+		if rest[0] == 'v' {
+			if val, ok := n.Value(); ok {
+				docs = append(docs, Text(fmt.Sprint(val)))
+			}
+			tmpl = rest[1:]
+			continue
+		}
+		end := 0
+		for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+			end++
+		}
+		idx, err := strconv.Atoi(rest[:end])
+		if err != nil {
+			docs = append(docs, Text("$"))
+			tmpl = rest
+			continue
+		}
+		if idx < len(children) {
+			docs = append(docs, children[idx])
+		}
+		tmpl = rest[end:]
+	}
+}
+
+func call(name string, children []Doc) Doc {
+	if len(children) == 0 {
+		return Text(name)
+	}
+	return Group(Concat(
+		Text(name+"("),
+		Nest(2, Concat(SoftLine(), Join(Concat(Text(","), Line()), children))),
+		SoftLine(),
+		Text(")"),
+	))
+}
+
+func hole(s *dsl.Symbol) Doc {
+	return Text("<" + s.Id + ">")
+}
+
+func (p *Printer) Doc(t *dsl.ProgramTree) Doc {
+	d, _ := p.doc(t)
+	return d
+}
+
+func (p *Printer) doc(t *dsl.ProgramTree) (Doc, int) {
+	children := make([]Doc, len(t.Children))
+	precs := make([]int, len(t.Children))
+	for i, c := range t.Children {
+		children[i], precs[i] = p.doc(c)
+	}
+
+	r, ok := p.rules[t.Symbol]
+	if !ok {
+		switch {
+		case len(children) == 1:
+			return children[0], precs[0]
+		case len(children) == 0 && !t.Symbol.IsTerminal():
+			return hole(t.Symbol), atomPrec
+		case len(children) == 0:
+			if val, ok := t.Value(); ok {
+				return Text(fmt.Sprint(val)), atomPrec
+			}
+			return Text(t.Symbol.Id), atomPrec
+		}
+		return call(t.Symbol.Id, children), atomPrec
+	}
+
+	last := len(children) - 1
+	paren := func(i int, d Doc) Doc {
+		need := precs[i] < r.prec
+		if precs[i] == r.prec {
+			switch r.assoc {
+			case Left:
+				need = i > 0
+			case Right:
+				need = i < last
+			default:
+				need = true
+			}
+		}
+		if need {
+			return Concat(Text("("), d, Text(")"))
+		}
+		return d
+	}
+	return r.render(t, children, paren), r.prec
+}
+
+func (p *Printer) Unparse(t *dsl.ProgramTree) string {
+	return Render(p.Doc(t), p.width)
+}
@@ -0,0 +1,152 @@
+package unparse
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/KeitaTakenouchi/grammars/dsl"
+	"github.com/KeitaTakenouchi/grammars/rewrite"
+)
+
+func newExpPrinter(g *dsl.Grammar) *Printer {
+	sym := func(id string) *dsl.Symbol {
+		s, _ := g.GetSymbol(id)
+		return s
+	}
+	return New(g).
+		Infix(sym("add"), "+", 1, Left).
+		Infix(sym("minus"), "-", 1, Left).
+		Infix(sym("mult"), "*", 2, Left).
+		Atom(sym("param"), func(v interface{}) string { return fmt.Sprintf("x%v", v) })
+}
+
+func TestPrinter_Unparse(t *testing.T) {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	plus := dsl.NewSymbol("add")
+	minus := dsl.NewSymbol("minus")
+	mult := dsl.NewSymbol("mult")
+	cnst := dsl.NewSymbol("const")
+	param := dsl.NewSymbol("param")
+
+	g := dsl.NewGrammar(S)
+	g.AddRule(S, exp)
+	g.AddRule(exp, plus)
+	g.AddRule(exp, minus)
+	g.AddRule(exp, mult)
+	g.AddRule(exp, cnst)
+	g.AddRule(exp, param)
+	g.AddRule(plus, exp, exp)
+	g.AddRule(minus, exp, exp)
+	g.AddRule(mult, exp, exp)
+
+	printer := newExpPrinter(&g)
+
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "lower precedence child",
+			src:  "S(exp(mult(exp(add(exp(const(1)), exp(param(0)))), exp(const(3)))))",
+			want: "(1 + x0) * 3",
+		},
+		{
+			name: "higher precedence child",
+			src:  "S(exp(add(exp(const(1)), exp(mult(exp(param(0)), exp(const(3)))))))",
+			want: "1 + x0 * 3",
+		},
+		{
+			name: "left associative",
+			src:  "exp(minus(exp(minus(exp(const(1)), exp(const(2)))), exp(const(3))))",
+			want: "1 - 2 - 3",
+		},
+		{
+			name: "right operand of the same precedence",
+			src:  "exp(minus(exp(const(1)), exp(add(exp(const(2)), exp(const(3))))))",
+			want: "1 - (2 + 3)",
+		},
+		{
+			name: "holes",
+			src:  "exp(add(exp, exp(param)))",
+			want: "<exp> + <param>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := rewrite.ParseTree(&g, tt.src)
+			if err != nil {
+				t.Fatalf("ParseTree(%q) error = %v", tt.src, err)
+			}
+			if got := printer.Unparse(tree); got != tt.want {
+				t.Errorf("Printer.Unparse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrinter_Layout(t *testing.T) {
+	S := dsl.NewSymbol("S")
+	exp := dsl.NewSymbol("exp")
+	plus := dsl.NewSymbol("add")
+	minus := dsl.NewSymbol("minus")
+	mult := dsl.NewSymbol("mult")
+	cnst := dsl.NewSymbol("const")
+	param := dsl.NewSymbol("param")
+
+	g := dsl.NewGrammar(S)
+	g.AddRule(S, exp)
+	g.AddRule(exp, plus)
+	g.AddRule(exp, minus)
+	g.AddRule(exp, mult)
+	g.AddRule(exp, cnst)
+	g.AddRule(exp, param)
+	g.AddRule(plus, exp, exp)
+	g.AddRule(minus, exp, exp)
+	g.AddRule(mult, exp, exp)
+
+	tree, err := rewrite.ParseTree(&g,
+		"exp(add(exp(mult(exp(param(0)), exp(param(1)))), exp(minus(exp(param(2)), exp(const(5))))))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		printer *Printer
+		want    string
+	}{
+		{
+			name:    "infix breaks after the operator",
+			printer: newExpPrinter(&g).SetWidth(12),
+			want:    "x0 * x1 +\n  (x2 - 5)",
+		},
+		{
+			name:    "call",
+			printer: New(&g).Call(plus, "plus").Call(mult, "times").Call(minus, "sub").SetWidth(20),
+			want:    "plus(\n  times(0, 1),\n  sub(2, 5)\n)",
+		},
+		{
+			name:    "template",
+			printer: newExpPrinter(&g).Template(plus, 0, "LET $0\nIN $1"),
+			want:    "LET x0 * x1 IN x2 - 5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.printer.Unparse(tree); got != tt.want {
+				t.Errorf("Printer.Unparse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("unknown symbol", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Printer.Infix() does not panic with a symbol outside the grammar")
+			}
+		}()
+		New(&g).Infix(dsl.NewSymbol("add"), "+", 1, Left)
+	})
+}